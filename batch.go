@@ -0,0 +1,264 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// A format is a file format that codeplugs can be converted to.
+// An atomic format's write already writes a temporary file and
+// renames it.
+type format struct {
+	ext    string
+	write  func(cp *codeplug.Codeplug, filename string) error
+	atomic bool
+}
+
+var formats = map[string]format{
+	"rdt":  {".rdt", (*codeplug.Codeplug).SaveAs, true},
+	"json": {".json", (*codeplug.Codeplug).ExportJSON, false},
+	"text": {".txt", (*codeplug.Codeplug).ExportText, false},
+	"xlsx": {".xlsx", (*codeplug.Codeplug).ExportXLSX, false},
+}
+
+// writeFormat writes cp to filename in format f without ever leaving a
+// partial file.  SaveAs is called with filename itself, since it
+// writes atomically and makes filename the codeplug's file.
+func writeFormat(cp *codeplug.Codeplug, f format, filename string) error {
+	if f.atomic {
+		return f.write(cp, filename)
+	}
+
+	return writeFileAtomically(filename, func(tmpName string) error {
+		return f.write(cp, tmpName)
+	})
+}
+
+func formatNames() []string {
+	return []string{"rdt", "json", "text", "xlsx"}
+}
+
+// withExtension returns filename, with ext appended if filename has
+// no extension, so that an output file may be named by its base name.
+func withExtension(filename string, ext string) string {
+	if filepath.Ext(filename) != "" {
+		return filename
+	}
+
+	return filename + ext
+}
+
+// gzExtension returns ext, followed by .gz if gz is true.
+func gzExtension(ext string, gz bool) string {
+	if gz {
+		return ext + ".gz"
+	}
+
+	return ext
+}
+
+// fileTypeOf returns the codeplug file type of filename, judged by its
+// extension.
+func fileTypeOf(filename string) codeplug.FileType {
+	ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(filename, ".gz")))
+	switch ext {
+	case ".json":
+		return codeplug.FileTypeJSON
+	case ".txt", ".text":
+		return codeplug.FileTypeText
+	case ".xlsx":
+		return codeplug.FileTypeXLSX
+	}
+
+	return codeplug.FileTypeNone
+}
+
+func fileSHA256(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// A manifest records the files converted by batchConvert with the
+// SHA-256 of each.
+type manifest struct {
+	file *os.File
+}
+
+func (m *manifest) add(inFilename string, outFilename string) error {
+	if m.file == nil {
+		return nil
+	}
+
+	inSum, err := fileSHA256(inFilename)
+	if err != nil {
+		return err
+	}
+
+	outSum, err := fileSHA256(outFilename)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(m.file, "%s\t%s\t%s\t%s\n", inSum, inFilename, outSum, outFilename)
+	return err
+}
+
+// upToDate reports whether outFilename exists and was modified no
+// earlier than inFilename.
+func upToDate(inFilename string, outFilename string) (bool, error) {
+	outInfo, err := os.Stat(outFilename)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	inInfo, err := os.Stat(inFilename)
+	if err != nil {
+		return false, err
+	}
+
+	return !outInfo.ModTime().Before(inInfo.ModTime()), nil
+}
+
+func batchConvert() (err error) {
+	var to string
+	var manifestFilename string
+	var skipExisting bool
+	var force bool
+
+	flags := flag.NewFlagSet("batchConvert", flag.ExitOnError)
+	flags.StringVar(&to, "to", "", "output format: "+strings.Join(formatNames(), ", "))
+	flags.StringVar(&manifestFilename, "manifest", "", "write the SHA-256 of each input and output file to this file")
+	flags.BoolVar(&skipExisting, "skip-existing", false, "skip inputs whose output file is not older than the input")
+	flags.BoolVar(&force, "force", false, "convert every input, overriding -skip-existing")
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s -to <format> [-skip-existing [-force]] <outDir> <inFile>...\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nConverts each <inFile> into <outDir>, giving each output file the\n")
+		errorf("base name of its input and the extension of <format>.  The format of\n")
+		errorf("each <inFile> is determined by its extension.\n")
+		errorf("Each line of the manifest holds the SHA-256 and name of an input\n")
+		errorf("file followed by the SHA-256 and name of its output file.\n")
+		errorf("With -skip-existing, an input whose output file's modification\n")
+		errorf("time is not older than its own is skipped, though it is still\n")
+		errorf("listed in the manifest.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) < 2 {
+		flags.Usage()
+	}
+	outFormat, ok := formats[to]
+	if !ok {
+		errorf("bad format\n\n")
+		flags.Usage()
+	}
+	outDir := args[0]
+	inFilenames := args[1:]
+
+	err = os.MkdirAll(outDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	var m manifest
+	if manifestFilename != "" {
+		m.file, err = os.Create(manifestFilename)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			cerr := m.file.Close()
+			if err == nil {
+				err = cerr
+			}
+		}()
+	}
+
+	for _, inFilename := range inFilenames {
+		base := filepath.Base(strings.TrimSuffix(inFilename, ".gz"))
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+		outFilename := filepath.Join(outDir, base+outFormat.ext)
+
+		if skipExisting && !force {
+			skip, err := upToDate(inFilename, outFilename)
+			if err != nil {
+				return err
+			}
+			if skip {
+				err = m.add(inFilename, outFilename)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s: %s is up to date\n", inFilename, outFilename)
+				continue
+			}
+		}
+
+		cp, err := loadCodeplug(fileTypeOf(inFilename), inFilename)
+		if err != nil {
+			return fmt.Errorf("%s: %s", inFilename, err.Error())
+		}
+
+		err = writeFormat(cp, outFormat, outFilename)
+		if err != nil {
+			return err
+		}
+
+		err = m.add(inFilename, outFilename)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s -> %s\n", inFilename, outFilename)
+	}
+
+	return nil
+}
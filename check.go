@@ -0,0 +1,368 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+func checkReferences() error {
+	flags := flag.NewFlagSet("checkReferences", flag.ExitOnError)
+	addIndexBaseFlag(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nReports each field in <codeplugFilename> that refers to a\n")
+		errorf("contact, scan list, zone, or other record that does not exist.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
+	filename := args[0]
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	dangling := danglingReferences(cp)
+	for _, ref := range dangling {
+		f := ref.field
+		fmt.Printf("%s: %s: no %s record named %q\n", recordName(f.Record()), f.TypeName(), ref.target, f.String())
+	}
+
+	if len(dangling) != 0 {
+		return fmt.Errorf("%s: %d dangling references", filename, len(dangling))
+	}
+
+	return nil
+}
+
+func reindex() error {
+	var ed editor
+
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	ed.addFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nRewrites <codeplugFilename> with its records stored compactly\n")
+		errorf("and all references renumbered to match.  References to records\n")
+		errorf("that do not exist are reported and cleared where possible.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
+	filename := args[0]
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	unresolved := 0
+	for _, ref := range danglingReferences(cp) {
+		f := ref.field
+		fmt.Printf("%s: %s: no %s record named %q", recordName(f.Record()), f.TypeName(), ref.target, f.String())
+
+		names := recordsByName(cp, ref.target)
+		cleared := false
+		for _, s := range f.Strings() {
+			if names[s] == nil && ed.setField(f, s) == nil {
+				cleared = true
+				break
+			}
+		}
+
+		if cleared {
+			fmt.Printf(", set to %q\n", f.String())
+		} else {
+			fmt.Printf(", not resolved\n")
+			unresolved++
+		}
+	}
+
+	err = ed.save(cp, filename)
+	if err != nil {
+		return err
+	}
+
+	if unresolved != 0 {
+		return fmt.Errorf("%s: %d references could not be resolved", filename, unresolved)
+	}
+
+	return nil
+}
+
+// codeplugProblems returns a description of each invalid field value
+// and each dangling reference in cp.
+func codeplugProblems(cp *codeplug.Codeplug) []string {
+	var problems []string
+
+	// Valid marks each field whose value is invalid.
+	cp.Valid()
+
+	for _, rType := range cp.RecordTypes() {
+		for _, r := range cp.Records(rType) {
+			for _, fType := range r.FieldTypes() {
+				for _, f := range r.Fields(fType) {
+					if f.IsInvalidValue() && f.IsEnabled() {
+						problems = append(problems, fmt.Sprintf("%s: %s: invalid value %q", recordName(r), f.TypeName(), f.String()))
+					}
+				}
+			}
+		}
+	}
+
+	for _, ref := range danglingReferences(cp) {
+		f := ref.field
+		problems = append(problems, fmt.Sprintf("%s: %s: no %s record named %q", recordName(f.Record()), f.TypeName(), ref.target, f.String()))
+	}
+
+	problems = append(problems, frequencyProblems(cp)...)
+
+	return problems
+}
+
+func validate(cp *codeplug.Codeplug, filename string) error {
+	problems := codeplugProblems(cp)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	for _, problem := range problems {
+		errorf("%s\n", problem)
+	}
+
+	return fmt.Errorf("%s: %d problems found", filename, len(problems))
+}
+
+var (
+	ftRxFrequency       = codeplug.FieldType("RxFrequency")
+	ftTxFrequencyOffset = codeplug.FieldType("TxFrequencyOffset")
+)
+
+// txFrequency returns the transmit frequency of channel r in MHz.
+// Channels store it as an offset from the receive frequency.
+func txFrequency(r *codeplug.Record) (float64, bool) {
+	rx := r.Field(ftRxFrequency)
+	offset := r.Field(ftTxFrequencyOffset)
+	if rx == nil || offset == nil {
+		return 0, false
+	}
+
+	rxFreq, err := strconv.ParseFloat(rx.String(), 64)
+	if err != nil {
+		return 0, false
+	}
+
+	offsetFreq, err := strconv.ParseFloat(offset.String(), 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return rxFreq + offsetFreq, true
+}
+
+// A band is a range of frequencies in MHz.
+type band struct {
+	low  float64
+	high float64
+}
+
+func (b band) String() string {
+	return fmt.Sprintf("%g-%g MHz", b.low, b.high)
+}
+
+var bandRegexp = regexp.MustCompile(`(\d+(?:\.\d+)?)-(\d+(?:\.\d+)?)`)
+
+// frequencyBands returns the bands in a frequency range name, such as
+// "400-480_136-174".
+func frequencyBands(freqRange string) []band {
+	var bands []band
+	for _, match := range bandRegexp.FindAllStringSubmatch(freqRange, -1) {
+		low, err1 := strconv.ParseFloat(match[1], 64)
+		high, err2 := strconv.ParseFloat(match[2], 64)
+		if err1 == nil && err2 == nil {
+			bands = append(bands, band{low, high})
+		}
+	}
+
+	return bands
+}
+
+func inBands(freq float64, bands []band) bool {
+	for _, b := range bands {
+		if freq >= b.low && freq <= b.high {
+			return true
+		}
+	}
+
+	return false
+}
+
+// frequencyProblems returns a description of each channel frequency in
+// cp that lies outside of the codeplug's frequency range.
+func frequencyProblems(cp *codeplug.Codeplug) []string {
+	_, freqRange := loadedModel(cp)
+	bands := frequencyBands(freqRange)
+	if len(bands) == 0 {
+		return nil
+	}
+
+	var problems []string
+	for _, r := range cp.Records(rtChannels) {
+		problems = append(problems, channelFrequencyProblems(r, freqRange, bands)...)
+	}
+
+	return problems
+}
+
+const ftRxOnly = codeplug.FieldType("RxOnly")
+
+// channelFrequencyProblems returns a description of each frequency of
+// channel r outside of bands.  Receive and transmit frequencies are
+// reported separately, since a channel whose receive frequency is in
+// range looks usable but will not key up if its transmit frequency is
+// not.  The transmit frequency is the receive frequency plus the
+// channel's TxFrequencyOffset.  The transmit frequency of a
+// receive-only channel is not checked.
+func channelFrequencyProblems(r *codeplug.Record, freqRange string, bands []band) []string {
+	var problems []string
+
+	f := r.Field(ftRxFrequency)
+	if f != nil {
+		freq, err := strconv.ParseFloat(f.String(), 64)
+		if err == nil && !inBands(freq, bands) {
+			problems = append(problems, fmt.Sprintf("%s: %s: %s MHz is outside of the receive range %s", recordName(r), f.TypeName(), f.String(), freqRange))
+		}
+	}
+
+	rxOnly := r.Field(ftRxOnly)
+	if rxOnly != nil && rxOnly.String() == "On" {
+		return problems
+	}
+
+	freq, ok := txFrequency(r)
+	if ok && !inBands(freq, bands) {
+		f = r.Field(ftTxFrequencyOffset)
+		problems = append(problems, fmt.Sprintf("%s: %s: %s MHz puts the transmit frequency at %.5f MHz, outside of the transmit range %s, the radio will not transmit on this channel", recordName(r), f.TypeName(), f.String(), freq, freqRange))
+	}
+
+	return problems
+}
+
+func checkFrequencies(cp *codeplug.Codeplug, filename string) error {
+	problems := frequencyProblems(cp)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	for _, problem := range problems {
+		errorf("%s\n", problem)
+	}
+
+	return fmt.Errorf("%s: %d frequencies out of range", filename, len(problems))
+}
+
+func validateCodeplug() error {
+	keepGoing := true
+
+	flags := flag.NewFlagSet("validateCodeplug", flag.ExitOnError)
+	flags.BoolVar(&keepGoing, "keep-going", keepGoing, "validate every file, even after one fails")
+	addIndexBaseFlag(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFile>...\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nValidates each codeplug file, reporting invalid field values,\n")
+		errorf("references to records that do not exist, and frequencies outside\n")
+		errorf("of the codeplug's frequency range.  Each <codeplugFile> may be a\n")
+		errorf("glob pattern, such as \"codeplugs/*.rdt\".  Fails if any file fails.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+	}
+
+	var filenames []string
+	for _, pattern := range args {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		if matches == nil {
+			matches = []string{pattern}
+		}
+		filenames = append(filenames, matches...)
+	}
+
+	passed := 0
+	failed := 0
+	for _, filename := range filenames {
+		cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+		if err == nil {
+			err = validate(cp, filename)
+		}
+
+		if err != nil {
+			fmt.Printf("FAIL %s: %s\n", filename, err.Error())
+			failed++
+			if !keepGoing {
+				break
+			}
+			continue
+		}
+
+		fmt.Printf("ok   %s\n", filename)
+		passed++
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed != 0 {
+		return fmt.Errorf("%d of %d codeplugs failed validation", failed, passed+failed)
+	}
+
+	return nil
+}
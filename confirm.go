@@ -0,0 +1,88 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// A confirmation is shared by all subcommands that erase or overwrite
+// data in the radio.  Such subcommands ask before proceeding unless -yes
+// is given.  When stdin is not a terminal, they fail rather than wait
+// for an answer that cannot come.
+type confirmation struct {
+	yes bool
+}
+
+func (c *confirmation) addFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&c.yes, "yes", false, "proceed without asking for confirmation")
+}
+
+func (c *confirmation) confirm(prompt string) error {
+	if c.yes {
+		return nil
+	}
+
+	if !isTerminal(os.Stdin) {
+		return errors.New("not confirmed: stdin is not a terminal, use -yes to proceed")
+	}
+
+	fmt.Printf("%s [y/N]? ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	if answer != "y" && answer != "yes" {
+		return errors.New("cancelled")
+	}
+
+	return nil
+}
+
+// awaitDFUMode waits while the user puts the radio back in DFU mode.
+// The radio leaves DFU mode at the end of each read or write of its
+// flash, so a subcommand that reads and then writes must ask for it.
+func awaitDFUMode() error {
+	if !isTerminal(os.Stdin) {
+		return errors.New("the radio must be put back in DFU mode, but stdin is not a terminal")
+	}
+
+	fmt.Printf("\nTurn the radio off, then turn it on while holding PTT and the\n")
+	fmt.Printf("button above it, and press Enter once it is in DFU mode: ")
+	_, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	return err
+}
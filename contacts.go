@@ -0,0 +1,196 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+const (
+	ftCallID   = codeplug.FieldType("CallID")
+	ftCallType = codeplug.FieldType("CallType")
+)
+
+// userCallsigns returns the callsign of each user in usersFilename,
+// indexed by DMR ID.
+func userCallsigns(usersFilename string) (map[int]string, error) {
+	db, err := usersFromFile(usersFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	callsigns := make(map[int]string)
+	for _, u := range db.Users() {
+		callsigns[u.ID] = u.Callsign
+	}
+
+	return callsigns, nil
+}
+
+func generateContacts() error {
+	var usersFilename string
+	var ed editor
+
+	flags := flag.NewFlagSet("generateContacts", flag.ExitOnError)
+	flags.StringVar(&usersFilename, "users", "", "name contacts after the callsign of their ID in this users file")
+	ed.addFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s [-users <usersFile>] <codeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nAdds a group call contact to <codeplugFilename> for each ID that\n")
+		errorf("a channel or other record refers to as a contact, but that has\n")
+		errorf("no contact.  Each contact is named by its ID, or with -users, by\n")
+		errorf("the callsign of the ID if it has one.\n")
+		errorf("\n<codeplugFilename> must be a text or JSON codeplug.  In other\n")
+		errorf("formats, a reference to a missing contact holds a position in\n")
+		errorf("the contact list rather than an ID.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
+	filename := args[0]
+
+	fType := fileTypeOf(filename)
+	if fType != codeplug.FileTypeText && fType != codeplug.FileTypeJSON {
+		return fmt.Errorf("%s: not a text or JSON codeplug, contact IDs are unknown", filename)
+	}
+
+	cp, err := loadCodeplug(fType, filename)
+	if err != nil {
+		return err
+	}
+
+	var callsigns map[int]string
+	if usersFilename != "" {
+		callsigns, err = userCallsigns(usersFilename)
+		if err != nil {
+			return err
+		}
+	}
+
+	m := merger{ed: &ed, cp: cp}
+	created := make(map[int]string)
+	for _, ref := range danglingReferences(cp) {
+		if ref.target != rtContacts {
+			continue
+		}
+
+		id, err := strconv.Atoi(ref.field.String())
+		if err != nil || id <= 0 {
+			continue
+		}
+
+		name, ok := created[id]
+		if !ok {
+			name = strconv.Itoa(id)
+			if callsigns[id] != "" {
+				name = callsigns[id]
+			}
+			if recordsByName(cp, rtContacts)[name] != nil {
+				name = uniqueName(recordsByName(cp, rtContacts), name)
+			}
+
+			r, err := m.addRecord(rtContacts, name)
+			if err != nil {
+				return err
+			}
+
+			for _, fv := range []struct {
+				fType codeplug.FieldType
+				value string
+			}{
+				{ftCallID, strconv.Itoa(id)},
+				{ftCallType, "Group"},
+			} {
+				f := r.Field(fv.fType)
+				if f == nil {
+					continue
+				}
+				err = ed.setField(f, fv.value)
+				if err != nil {
+					return err
+				}
+			}
+
+			created[id] = name
+		}
+
+		err = ed.setField(ref.field, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Created %d contacts\n", len(created))
+
+	return ed.save(cp, filename)
+}
+
+// callTypes are the values of a contact's call type.
+var callTypes = []string{"Group", "Private", "All"}
+
+func addCallTypeFlag(flags *flag.FlagSet, callType *string) {
+	usage := fmt.Sprintf("include only the contacts with this call type, one of %s", strings.Join(callTypes, ", "))
+	flags.StringVar(callType, "call-type", "", usage)
+}
+
+func printCallTypeUsage() {
+	errorf("With -call-type, only the contacts of that call type are included,\n")
+	errorf("so that group and private contacts can be exported separately.\n")
+}
+
+// keepCallType removes the contacts in cp whose call type is not
+// callType, so that group and private contacts can be exported to
+// separate files.
+func keepCallType(cp *codeplug.Codeplug, callType string) error {
+	valid := false
+	for _, ct := range callTypes {
+		if strings.EqualFold(ct, callType) {
+			valid = true
+		}
+	}
+	if !valid {
+		return fmt.Errorf("bad -call-type %s, must be one of %s", callType, strings.Join(callTypes, ", "))
+	}
+
+	expr := fmt.Sprintf("%s == %s", ftCallType, callType)
+	removed, err := filterRecords(cp, rtContacts, expr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d contacts did not match -call-type\n", removed)
+
+	return nil
+}
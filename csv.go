@@ -0,0 +1,310 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// csvValueSeparator separates the values of a multi-valued field
+// within a CSV cell.
+const csvValueSeparator = "\n"
+
+// csvRecordType returns the record type of cp named name, matched as
+// importCSV matches column names.
+func csvRecordType(cp *codeplug.Codeplug, name string) (codeplug.RecordType, error) {
+	for _, rType := range cp.RecordTypes() {
+		if columnKey(string(rType)) == columnKey(name) {
+			return rType, nil
+		}
+	}
+
+	return "", fmt.Errorf("no record type %q", name)
+}
+
+// setFields sets the fields of type fType of r to values, adding and
+// removing fields as needed.
+func (m *merger) setFields(r *codeplug.Record, fType codeplug.FieldType, values []string) error {
+	// NewField describes fType to r, which MaxFields needs when r
+	// has no fields of that type.
+	r.NewField(fType)
+	if len(values) > r.MaxFields(fType) {
+		return fmt.Errorf("%s: too many %s values, the maximum is %d", recordName(r), fType, r.MaxFields(fType))
+	}
+
+	fields := r.Fields(fType)
+	for i, value := range values {
+		if i < len(fields) {
+			err := m.ed.setField(fields[i], value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := m.addField(r, fType, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(fields) > len(values) {
+		// RemoveField shifts the fields, so iterate over a copy.
+		for _, f := range append([]*codeplug.Field(nil), fields[len(values):]...) {
+			m.ed.record(r, f.TypeName(), f.String(), "")
+			r.RemoveField(f)
+		}
+	}
+
+	return nil
+}
+
+func codeplugToCSV() error {
+	flags := flag.NewFlagSet("codeplugToCSV", flag.ExitOnError)
+	addStdinFlags(flags)
+	addIndexBaseFlag(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFilename> <recordType> <csvFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nWrites the records of <recordType> in <codeplugFilename>, such\n")
+		errorf("as Channels, Contacts, or Zones, to <csvFilename>, one row per\n")
+		errorf("record under a header row of field names.  The values of a\n")
+		errorf("multi-valued field, such as a zone's channels, are written one\n")
+		errorf("per line within their cell.  The first column holds the\n")
+		errorf("record numbers, counted from -base.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 3 {
+		flags.Usage()
+	}
+	filename := args[0]
+	csvFilename := withExtension(args[2], ".csv")
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	rType, err := csvRecordType(cp, args[1])
+	if err != nil {
+		return fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	fTypes := newRecord(cp, rType).AllFieldTypes()
+	header := []string{numberColumn}
+	for _, fType := range fTypes {
+		header = append(header, string(fType))
+	}
+
+	return createFileAtomically(csvFilename, func(file io.Writer) error {
+		w := csv.NewWriter(file)
+		w.Write(header)
+		for _, r := range cp.Records(rType) {
+			row := []string{strconv.Itoa(recordNumber(r))}
+			for _, fType := range fTypes {
+				row = append(row, strings.Join(fieldValues(r, fType), csvValueSeparator))
+			}
+			w.Write(row)
+		}
+		w.Flush()
+		return w.Error()
+	})
+}
+
+func csvToCodeplug() error {
+	var ed editor
+
+	flags := flag.NewFlagSet("csvToCodeplug", flag.ExitOnError)
+	ed.addFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFilename> <recordType> <csvFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nReplaces the records of <recordType> in <codeplugFilename> with\n")
+		errorf("the rows of <csvFilename>, in the form written by codeplugToCSV.\n")
+		errorf("Records are matched to rows by name: matching records are updated,\n")
+		errorf("rows without one are added, and records without a row are removed.\n")
+		errorf("The records are then ordered as their rows are.  Records of other\n")
+		errorf("types are left as they are.  Single-valued fields whose column is\n")
+		errorf("missing or whose cell is empty keep their existing or default\n")
+		errorf("values.  Unlike importCSV, which only adds and updates, the CSV\n")
+		errorf("file holds every record of <recordType>.  A record that another\n")
+		errorf("record refers to is not removed; the command fails instead.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 3 {
+		flags.Usage()
+	}
+	filename := args[0]
+	csvFilename := args[2]
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	rType, err := csvRecordType(cp, args[1])
+	if err != nil {
+		return fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	file, err := os.Open(csvFilename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("%s: %s", csvFilename, err.Error())
+	}
+
+	columns, err := csvColumns(cp, rType, header, true)
+	if err != nil {
+		return fmt.Errorf("%s: %s", csvFilename, err.Error())
+	}
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return fmt.Errorf("%s: %s", csvFilename, err.Error())
+	}
+
+	m := merger{ed: &ed, cp: cp}
+	names := recordsByName(cp, rType)
+	var kept []*codeplug.Record
+	seen := make(map[*codeplug.Record]bool)
+	for i, row := range rows {
+		line := i + 2
+
+		name := ""
+		for j, value := range row {
+			if j < len(columns) && columns[j] == ftName {
+				name = strings.TrimSpace(value)
+			}
+		}
+		if name == "" {
+			err = warnf("%s:%d: skipping row without a name", csvFilename, line)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		r := names[name]
+		if seen[r] {
+			return fmt.Errorf("%s:%d: %s %q is in more than one row", csvFilename, line, rType, name)
+		}
+		if r == nil {
+			r, err = m.addRecord(rType, name)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s", csvFilename, line, err.Error())
+			}
+			names[name] = r
+		}
+		seen[r] = true
+		kept = append(kept, r)
+
+		for j, value := range row {
+			if j >= len(columns) || columns[j] == "" || columns[j] == ftName {
+				continue
+			}
+			fType := columns[j]
+
+			r.NewField(fType)
+			if r.MaxFields(fType) > 1 {
+				var values []string
+				if value != "" {
+					value = strings.Replace(value, "\r\n", "\n", -1)
+					values = strings.Split(value, csvValueSeparator)
+				}
+				err = m.setFields(r, fType, values)
+			} else if value == "" {
+				continue
+			} else if f := r.Field(fType); f == nil {
+				err = m.addField(r, fType, value)
+			} else {
+				err = ed.setField(f, value)
+			}
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s", csvFilename, line, err.Error())
+			}
+		}
+	}
+
+	// A reference to a removed record would keep its old index,
+	// naming whichever record moves into its place, so records that
+	// other records refer to are not removed.
+	removed := make(map[string]bool)
+	for _, r := range cp.Records(rType) {
+		if !seen[r] {
+			removed[r.Name()] = true
+		}
+	}
+	for _, ref := range references(cp) {
+		f := ref.field
+		if ref.target != rType || !removed[f.String()] {
+			continue
+		}
+		if f.Record().Type() == rType && removed[f.Record().Name()] {
+			continue
+		}
+		return fmt.Errorf("%s: %s: %s %q has no row in %s",
+			recordName(f.Record()), f.TypeName(), rType, f.String(), csvFilename)
+	}
+
+	// RemoveRecord shifts the records, so iterate over a copy.
+	for _, r := range append([]*codeplug.Record(nil), cp.Records(rType)...) {
+		if !seen[r] {
+			ed.record(r, "", "", "removed")
+			cp.RemoveRecord(r)
+		}
+	}
+
+	for i, r := range kept {
+		if r.Index() != i {
+			ed.record(r, "", "", fmt.Sprintf("moved to %d", i+indexBase))
+			cp.MoveRecord(i, r)
+		}
+	}
+
+	return ed.save(cp, filename)
+}
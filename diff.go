@@ -0,0 +1,351 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+type diffKind int
+
+const (
+	diffAdded diffKind = iota
+	diffRemoved
+	diffChanged
+)
+
+func (k diffKind) String() string {
+	switch k {
+	case diffAdded:
+		return "added"
+	case diffRemoved:
+		return "removed"
+	}
+
+	return "changed"
+}
+
+// A fieldDiff is a field whose values differ between two records.
+type fieldDiff struct {
+	name string
+	a    []string
+	b    []string
+}
+
+// A recordDiff is a record present in only one of two codeplugs, or
+// present in both with different field values.  A recordDiff without a
+// name is a record type that only one of the codeplugs' models has.
+type recordDiff struct {
+	rType  codeplug.RecordType
+	name   string
+	kind   diffKind
+	fields []fieldDiff
+}
+
+// recordKey identifies a record across codeplugs: by name if it has
+// one, otherwise by its position.
+func recordKey(r *codeplug.Record) string {
+	if r.Name() != "" {
+		return r.Name()
+	}
+
+	return fmt.Sprintf("#%d", recordNumber(r))
+}
+
+func fieldValues(r *codeplug.Record, fType codeplug.FieldType) []string {
+	var values []string
+	for _, f := range r.Fields(fType) {
+		values = append(values, f.String())
+	}
+
+	return values
+}
+
+func diffFields(a *codeplug.Record, b *codeplug.Record) []fieldDiff {
+	var diffs []fieldDiff
+
+	fTypes := a.FieldTypes()
+	seen := make(map[codeplug.FieldType]bool)
+	for _, fType := range fTypes {
+		seen[fType] = true
+	}
+	for _, fType := range b.FieldTypes() {
+		if !seen[fType] {
+			fTypes = append(fTypes, fType)
+		}
+	}
+
+	for _, fType := range fTypes {
+		aValues := fieldValues(a, fType)
+		bValues := fieldValues(b, fType)
+		if strings.Join(aValues, "\n") == strings.Join(bValues, "\n") {
+			continue
+		}
+
+		diffs = append(diffs, fieldDiff{string(fType), aValues, bValues})
+	}
+
+	return diffs
+}
+
+// diffCodeplugRecords returns the records that differ between a and b,
+// in the order of a's record types.  The records of a type that only
+// one of a and b has are not compared; the type is reported instead.
+func diffCodeplugRecords(a *codeplug.Codeplug, b *codeplug.Codeplug) []recordDiff {
+	var diffs []recordDiff
+
+	rTypes := a.RecordTypes()
+	inA := make(map[codeplug.RecordType]bool)
+	for _, rType := range rTypes {
+		inA[rType] = true
+	}
+	inB := make(map[codeplug.RecordType]bool)
+	for _, rType := range b.RecordTypes() {
+		inB[rType] = true
+		if !inA[rType] {
+			rTypes = append(rTypes, rType)
+		}
+	}
+
+	for _, rType := range rTypes {
+		// Records dereferences a missing record type.
+		if !inB[rType] {
+			diffs = append(diffs, recordDiff{rType, "", diffRemoved, nil})
+			continue
+		}
+		if !inA[rType] {
+			diffs = append(diffs, recordDiff{rType, "", diffAdded, nil})
+			continue
+		}
+
+		bRecords := make(map[string]*codeplug.Record)
+		for _, r := range b.Records(rType) {
+			bRecords[recordKey(r)] = r
+		}
+
+		aKeys := make(map[string]bool)
+		for _, rA := range a.Records(rType) {
+			key := recordKey(rA)
+			aKeys[key] = true
+
+			rB := bRecords[key]
+			if rB == nil {
+				diffs = append(diffs, recordDiff{rType, key, diffRemoved, nil})
+				continue
+			}
+
+			fields := diffFields(rA, rB)
+			if len(fields) != 0 {
+				diffs = append(diffs, recordDiff{rType, key, diffChanged, fields})
+			}
+		}
+
+		for _, rB := range b.Records(rType) {
+			key := recordKey(rB)
+			if !aKeys[key] {
+				diffs = append(diffs, recordDiff{rType, key, diffAdded, nil})
+			}
+		}
+	}
+
+	return diffs
+}
+
+// diffStats summarizes diffs as, e.g.,
+// "Channels: 2 changed, 1 added; Zones: 1 removed".
+func diffStats(diffs []recordDiff) string {
+	type counts [3]int
+
+	var rTypes []codeplug.RecordType
+	typeCounts := make(map[codeplug.RecordType]*counts)
+	for _, d := range diffs {
+		c := typeCounts[d.rType]
+		if c == nil {
+			c = new(counts)
+			typeCounts[d.rType] = c
+			rTypes = append(rTypes, d.rType)
+		}
+		c[d.kind]++
+	}
+
+	var summaries []string
+	for _, rType := range rTypes {
+		c := typeCounts[rType]
+		var parts []string
+		for _, k := range []diffKind{diffChanged, diffAdded, diffRemoved} {
+			if c[k] != 0 {
+				parts = append(parts, fmt.Sprintf("%d %s", c[k], k))
+			}
+		}
+		summaries = append(summaries, fmt.Sprintf("%s: %s", rType, strings.Join(parts, ", ")))
+	}
+
+	if len(summaries) == 0 {
+		return "no differences"
+	}
+
+	return strings.Join(summaries, "; ")
+}
+
+// diffFromDefaults returns the differences of cp from def, the factory
+// default codeplug of its model.  Each record added in cp is compared
+// with a new record of its type, so only its fields that differ from
+// their defaults are reported.
+func diffFromDefaults(def *codeplug.Codeplug, cp *codeplug.Codeplug) []recordDiff {
+	diffs := diffCodeplugRecords(def, cp)
+
+	records := make(map[codeplug.RecordType]map[string]*codeplug.Record)
+	for i := range diffs {
+		d := &diffs[i]
+		if d.kind != diffAdded || d.name == "" {
+			continue
+		}
+
+		if records[d.rType] == nil {
+			records[d.rType] = make(map[string]*codeplug.Record)
+			for _, r := range cp.Records(d.rType) {
+				records[d.rType][recordKey(r)] = r
+			}
+		}
+
+		d.fields = diffFields(newRecord(def, d.rType), records[d.rType][d.name])
+	}
+
+	return diffs
+}
+
+func printDiffs(diffs []recordDiff) {
+	for _, d := range diffs {
+		if d.name == "" {
+			fmt.Printf("%s: record type %s\n", d.rType, d.kind)
+			continue
+		}
+
+		if d.kind != diffChanged {
+			fmt.Printf("%s %q: %s\n", d.rType, d.name, d.kind)
+		}
+
+		for _, f := range d.fields {
+			fmt.Printf("%s %q: %s: %q -> %q\n", d.rType, d.name, f.name,
+				strings.Join(f.a, ","), strings.Join(f.b, ","))
+		}
+	}
+}
+
+func diffCodeplugs() error {
+	var stats bool
+
+	flags := flag.NewFlagSet("diffCodeplugs", flag.ExitOnError)
+	flags.BoolVar(&stats, "stats", false, "print only the number of records changed, added, and removed")
+	addIndexBaseFlag(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFileA> <codeplugFileB>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nLists the records added, removed, or changed in going from\n")
+		errorf("<codeplugFileA> to <codeplugFileB>.  Records are matched by name,\n")
+		errorf("or by position if they have no name.\n")
+		errorf("\nExits with status 1 if the codeplugs differ, as diff(1) does.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 2 {
+		flags.Usage()
+	}
+
+	a, err := loadCodeplug(codeplug.FileTypeNone, args[0])
+	if err != nil {
+		return err
+	}
+
+	b, err := loadCodeplug(codeplug.FileTypeNone, args[1])
+	if err != nil {
+		return err
+	}
+
+	diffs := diffCodeplugRecords(a, b)
+	if stats {
+		fmt.Println(diffStats(diffs))
+	} else {
+		printDiffs(diffs)
+	}
+
+	if len(diffs) != 0 {
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+func diffDefaults() error {
+	var stats bool
+
+	flags := flag.NewFlagSet("diffDefaults", flag.ExitOnError)
+	flags.BoolVar(&stats, "stats", false, "print only the number of records changed, added, and removed")
+	addIndexBaseFlag(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFile>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nLists what differs in <codeplugFile> from the factory default\n")
+		errorf("codeplug of its model: the fields changed in default records, the\n")
+		errorf("records removed, and the records added with their fields that\n")
+		errorf("differ from the defaults of a new record.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, args[0])
+	if err != nil {
+		return err
+	}
+
+	typ, freqRange := loadedModel(cp)
+	def, err := defaultCodeplug(typ, freqRange)
+	if err != nil {
+		return err
+	}
+
+	diffs := diffFromDefaults(def, cp)
+	if stats {
+		fmt.Println(diffStats(diffs))
+		return nil
+	}
+
+	printDiffs(diffs)
+
+	return nil
+}
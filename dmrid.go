@@ -0,0 +1,143 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+const ftRadioID = codeplug.FieldType("RadioID")
+
+// bootTextFields are the general settings fields expected to hold the
+// operator's callsign.
+var bootTextFields = []codeplug.FieldType{
+	"RadioName",
+	"IntroScreenLine1",
+	"IntroScreenLine2",
+}
+
+// checkDMRID returns a warning if id is not in the users file, or is
+// assigned to a callsign that does not appear in the boot text of the
+// general settings record r.
+func checkDMRID(r *codeplug.Record, id int, usersFilename string) (string, error) {
+	db, err := usersFromFile(usersFilename)
+	if err != nil {
+		return "", err
+	}
+
+	for _, u := range db.Users() {
+		if u.ID != id {
+			continue
+		}
+
+		callsign := strings.ToUpper(strings.TrimSpace(u.Callsign))
+		var texts []string
+		for _, fType := range bootTextFields {
+			f := r.Field(fType)
+			if f == nil {
+				continue
+			}
+			text := strings.TrimSpace(f.String())
+			if strings.Contains(strings.ToUpper(text), callsign) {
+				return "", nil
+			}
+			if text != "" {
+				texts = append(texts, text)
+			}
+		}
+
+		if len(texts) == 0 {
+			return "", nil
+		}
+
+		return fmt.Sprintf("DMR ID %d is assigned to %s, which is not in the boot text %q", id, u.Callsign, strings.Join(texts, " / ")), nil
+	}
+
+	return fmt.Sprintf("DMR ID %d is not assigned to anyone in %s", id, usersFilename), nil
+}
+
+func setDMRID() error {
+	var usersFilename string
+	var ed editor
+
+	flags := flag.NewFlagSet("setDMRID", flag.ExitOnError)
+	flags.StringVar(&usersFilename, "users", "", "warn if the ID is not assigned, or assigned to another callsign, in this users file")
+	ed.addFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFilename> <dmrID>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nSets the radio's DMR ID in <codeplugFilename>.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 2 {
+		flags.Usage()
+	}
+	filename := args[0]
+
+	id, err := strconv.Atoi(args[1])
+	if err != nil || id <= 0 {
+		errorf("bad DMR ID: %s\n\n", args[1])
+		flags.Usage()
+	}
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	r := firstRecord(cp, rtGeneralSettings)
+	if r == nil || r.Field(ftRadioID) == nil {
+		return fmt.Errorf("%s: no radio ID in general settings", filename)
+	}
+
+	if usersFilename != "" {
+		warning, err := checkDMRID(r, id, usersFilename)
+		if err != nil {
+			return err
+		}
+		if warning != "" {
+			err = warnf("%s", warning)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = ed.setField(r.Field(ftRadioID), strconv.Itoa(id))
+	if err != nil {
+		return err
+	}
+
+	return ed.save(cp, filename)
+}
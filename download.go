@@ -0,0 +1,283 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dalefarnsworth-dmr/userdb"
+)
+
+// downloadTransport wraps the default HTTP transport for the downloads
+// dmrRadio makes itself, such as -from-url.  It rejects error responses
+// and HTML pages, so that a source that is down produces an error rather
+// than an empty or garbage user database, and it abandons any download
+// still running at the deadline set by -timeout.  The userdb package
+// downloads through its own unexported client, which this cannot reach,
+// so downloadUsers enforces the deadline for its downloads instead.
+type downloadTransport struct {
+	base      http.RoundTripper
+	deadline  time.Time
+	userAgent string
+}
+
+var transport *downloadTransport
+
+// downloadClient makes dmrRadio's own downloads through transport.
+var downloadClient = &http.Client{}
+
+// defaultDownloadTimeout is the default time allowed for all of the
+// downloads made by a subcommand.
+const defaultDownloadTimeout = 60 * time.Second
+
+// maxDownloadRetries is the number of times a download is retried when
+// the server responds that it is busy.
+const maxDownloadRetries = 3
+
+func addDownloadFlags(flags *flag.FlagSet) {
+	addTimeoutFlag(flags)
+	// userdb sends Go's default User-Agent, which cannot be changed.
+	flags.StringVar(&transport.userAgent, "user-agent", transport.userAgent, "User-Agent header sent with -from-url downloads, but not with userdb's own downloads of the user database")
+}
+
+func addTimeoutFlag(flags *flag.FlagSet) {
+	flags.Var(timeoutValue{}, "timeout", "time allowed for downloads, such as 90s or 5m")
+}
+
+type timeoutValue struct{}
+
+func (timeoutValue) String() string {
+	return defaultDownloadTimeout.String()
+}
+
+func (timeoutValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	setDownloadTimeout(d)
+	return nil
+}
+
+// setDownloadTimeout limits the total time of the downloads made by a
+// subcommand to d.
+func setDownloadTimeout(d time.Duration) {
+	downloadClient.Timeout = d
+	transport.deadline = time.Now().Add(d)
+}
+
+func (t *downloadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithDeadline(req.Context(), t.deadline)
+	req = req.WithContext(ctx)
+
+	header := make(http.Header)
+	for key, values := range req.Header {
+		header[key] = values
+	}
+	header.Set("User-Agent", t.userAgent)
+	req.Header = header
+
+	resp, err := t.retryRoundTrip(req)
+	if err != nil {
+		cancel()
+		if time.Now().After(t.deadline) {
+			return nil, fmt.Errorf("%s: timed out, see -timeout", req.URL)
+		}
+		return nil, err
+	}
+
+	body := resp.Body
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, closerFunc(func() error {
+		cancel()
+		return body.Close()
+	})}
+
+	return resp, nil
+}
+
+// retryRoundTrip retries requests that are refused with 429 Too Many
+// Requests or 503 Service Unavailable, waiting as long as the server's
+// Retry-After header asks, or with exponential backoff.
+func (t *downloadTransport) retryRoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := time.Second
+
+	for retries := 0; ; retries++ {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		busy := resp.StatusCode == http.StatusTooManyRequests ||
+			resp.StatusCode == http.StatusServiceUnavailable
+		if !busy || retries == maxDownloadRetries || req.Body != nil {
+			return t.checkResponse(req, resp)
+		}
+
+		wait := backoff
+		seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if err == nil && seconds >= 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+		backoff *= 2
+		resp.Body.Close()
+
+		if time.Now().Add(wait).After(t.deadline) {
+			return nil, fmt.Errorf("%s: %s, retry would exceed -timeout", req.URL, resp.Status)
+		}
+
+		errorf("%s: %s, retrying in %s\n", req.URL.Host, resp.Status, wait)
+		time.Sleep(wait)
+	}
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+func (t *downloadTransport) checkResponse(req *http.Request, resp *http.Response) (*http.Response, error) {
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", req.URL, resp.Status)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "text/html") {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: received a web page instead of data", req.URL)
+	}
+
+	body := bufio.NewReader(resp.Body)
+	head, _ := body.Peek(512)
+	if strings.HasPrefix(http.DetectContentType(head), "text/html") {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: received a web page instead of data", req.URL)
+	}
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, resp.Body}
+
+	return resp, nil
+}
+
+func installDownloadTransport() {
+	transport = &downloadTransport{
+		base:      http.DefaultTransport,
+		userAgent: "dmrRadio/" + version,
+	}
+	downloadClient.Transport = transport
+	setDownloadTimeout(defaultDownloadTimeout)
+}
+
+// downloadFile copies the contents of url into a new temporary file
+// and returns its name.  The caller must remove the file.
+func downloadFile(url string) (filename string, err error) {
+	resp, err := downloadClient.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	tmp, err := ioutil.TempFile("", "download.*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		cerr := tmp.Close()
+		if err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = io.Copy(tmp, resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return tmp.Name(), nil
+}
+
+// downloadUsers downloads a user database with userdb.New, giving up at
+// the deadline set by -timeout.  Like downloadTransport, it rejects
+// sources that served a web page or no users at all.  A download that
+// is given up on is left to finish in the background, since userdb
+// cannot be interrupted.
+func downloadUsers(options ...userdb.DBOption) (*userdb.UsersDB, error) {
+	type result struct {
+		db  *userdb.UsersDB
+		err error
+	}
+	results := make(chan result, 1)
+
+	go func() {
+		db, err := userdb.New(options...)
+		results <- result{db, err}
+	}()
+
+	select {
+	case r := <-results:
+		if r.err != nil {
+			return nil, usersDownloadError(r.err)
+		}
+		if len(r.db.Users()) == 0 {
+			return nil, errors.New("downloading users: received no users")
+		}
+		return r.db, nil
+	case <-time.After(time.Until(transport.deadline)):
+		return nil, errors.New("downloading users: timed out, see -timeout")
+	}
+}
+
+// usersDownloadError returns the error to report for err from userdb.New.
+// userdb does not check what it downloads, so a web page, such as an
+// error or login page, shows up as a line of it that failed to parse.
+func usersDownloadError(err error) error {
+	s := strings.ToLower(err.Error())
+	if strings.Contains(s, "<!doctype html") || strings.Contains(s, "<html") {
+		return errors.New("downloading users: received a web page instead of users")
+	}
+
+	return err
+}
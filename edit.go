@@ -0,0 +1,337 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// A change describes a single modification made by a mutating subcommand.
+type change struct {
+	r      *codeplug.Record
+	record string
+	field  string
+	old    string
+	new    string
+}
+
+// An editor is shared by all subcommands that modify a codeplug.
+// It records every change made and, when dryRun is set, prints the
+// changes instead of saving them.  Unless disabled, the
+// file being overwritten is first copied to <filename>.bak.
+type editor struct {
+	dryRun     bool
+	backup     bool
+	keepBackup bool
+	report     string
+	changes    []change
+}
+
+func (e *editor) addFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&e.dryRun, "dry-run", false, "print the intended changes without saving")
+	flags.StringVar(&e.report, "report", "text", "summarize the changes as text or json")
+	flags.BoolVar(&e.backup, "backup", true, "copy the file to <filename>.bak before overwriting it")
+	flags.BoolVar(&e.keepBackup, "keep-backup", true, "keep the backup file after a successful save")
+	addIndexBaseFlag(flags)
+}
+
+// indexBase is the number displayed for the first record of each type.
+// The radio numbers records from 1.
+var indexBase = 1
+
+type indexBaseValue struct{}
+
+func (indexBaseValue) String() string {
+	return strconv.Itoa(indexBase)
+}
+
+func (indexBaseValue) Set(s string) error {
+	switch s {
+	case "0", "1":
+		indexBase, _ = strconv.Atoi(s)
+		return nil
+	}
+
+	return errors.New("must be 0 or 1")
+}
+
+func addIndexBaseFlag(flags *flag.FlagSet) {
+	flags.Var(indexBaseValue{}, "base", "number of the first record of each type, 0 or 1")
+}
+
+func recordNumber(r *codeplug.Record) int {
+	return r.Index() + indexBase
+}
+
+// numberColumn heads the column of record numbers in CSV and XLSX
+// exports.  Importers ignore it.
+const numberColumn = "#"
+
+func recordName(r *codeplug.Record) string {
+	return fmt.Sprintf("%s %d (%s)", r.TypeName(), recordNumber(r), r.Name())
+}
+
+func (e *editor) record(r *codeplug.Record, field string, old string, new string) {
+	e.changes = append(e.changes, change{
+		r:      r,
+		record: recordName(r),
+		field:  field,
+		old:    old,
+		new:    new,
+	})
+}
+
+func (e *editor) setField(f *codeplug.Field, value string) error {
+	old := f.String()
+	if old == value {
+		return nil
+	}
+
+	err := f.SetString(value)
+	if err != nil {
+		return fmt.Errorf("%s %s: %s", recordName(f.Record()), f.TypeName(), err.Error())
+	}
+
+	err = checkFieldFrequency(f)
+	if err != nil {
+		f.SetString(old)
+		return err
+	}
+
+	e.record(f.Record(), f.TypeName(), old, value)
+	return nil
+}
+
+// checkFieldFrequency returns an error if f is a channel frequency
+// field whose new value puts the channel outside of the codeplug's
+// frequency range.
+func checkFieldFrequency(f *codeplug.Field) error {
+	r := f.Record()
+	if r.Type() != rtChannels {
+		return nil
+	}
+	if f.Type() != ftRxFrequency && f.Type() != ftTxFrequencyOffset {
+		return nil
+	}
+
+	_, freqRange := loadedModel(f.Codeplug())
+	bands := frequencyBands(freqRange)
+	if len(bands) == 0 {
+		return nil
+	}
+
+	problems := channelFrequencyProblems(r, freqRange, bands)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return errors.New(problems[0])
+}
+
+func (e *editor) printChanges() {
+	for _, c := range e.changes {
+		fmt.Printf("%s: %s: %q -> %q\n", c.record, c.field, c.old, c.new)
+	}
+}
+
+func (e *editor) save(cp *codeplug.Codeplug, filename string) error {
+	if e.report != "text" && e.report != "json" {
+		return fmt.Errorf("bad -report: %s, must be text or json", e.report)
+	}
+
+	err := e.checkFrequencies(cp)
+	if err != nil {
+		return err
+	}
+
+	if e.dryRun {
+		if e.report == "text" {
+			e.printChanges()
+			fmt.Printf("Dry run: %d changes not saved\n", len(e.changes))
+		}
+		return e.printReport(cp)
+	}
+
+	f := saveFormat(filename)
+	err = e.saveFile(filename, func(name string) error {
+		return writeFormat(cp, f, name)
+	})
+	if err != nil {
+		return err
+	}
+
+	return e.printReport(cp)
+}
+
+// saveFormat returns the format in which an edited codeplug is saved
+// to filename: text, JSON, or XLSX if its extension names one, and the
+// radio's own format otherwise.
+func saveFormat(filename string) format {
+	switch fileTypeOf(filename) {
+	case codeplug.FileTypeText:
+		return formats["text"]
+	case codeplug.FileTypeJSON:
+		return formats["json"]
+	case codeplug.FileTypeXLSX:
+		return formats["xlsx"]
+	}
+
+	return formats["rdt"]
+}
+
+// checkFrequencies returns an error if a channel changed by e has a
+// frequency outside of the frequency range of cp.
+func (e *editor) checkFrequencies(cp *codeplug.Codeplug) error {
+	_, freqRange := loadedModel(cp)
+	bands := frequencyBands(freqRange)
+	if len(bands) == 0 {
+		return nil
+	}
+
+	checked := make(map[*codeplug.Record]bool)
+	var problems []string
+	for _, c := range e.changes {
+		if checked[c.r] || c.r.Type() != rtChannels {
+			continue
+		}
+		checked[c.r] = true
+
+		problems = append(problems, channelFrequencyProblems(c.r, freqRange, bands)...)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	for _, problem := range problems {
+		errorf("%s\n", problem)
+	}
+
+	return fmt.Errorf("%d frequencies outside of the frequency range %s, not saved", len(problems), freqRange)
+}
+
+// A typeReport counts the records of a type that were modified.
+type typeReport struct {
+	Type     codeplug.RecordType `json:"type"`
+	Modified int                 `json:"modified"`
+	Total    int                 `json:"total"`
+}
+
+type changeReport struct {
+	Record string `json:"record"`
+	Field  string `json:"field,omitempty"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+type editReport struct {
+	Saved       bool           `json:"saved"`
+	RecordTypes []typeReport   `json:"recordTypes"`
+	Changes     []changeReport `json:"changes"`
+}
+
+// printReport summarizes the changes made to cp, e.g.
+// "Modified 42 of 347 Channels".
+func (e *editor) printReport(cp *codeplug.Codeplug) error {
+	report := editReport{
+		Saved:       !e.dryRun,
+		RecordTypes: []typeReport{},
+		Changes:     []changeReport{},
+	}
+
+	modified := make(map[codeplug.RecordType]map[*codeplug.Record]bool)
+	for _, c := range e.changes {
+		rType := c.r.Type()
+		if modified[rType] == nil {
+			modified[rType] = make(map[*codeplug.Record]bool)
+		}
+		modified[rType][c.r] = true
+
+		report.Changes = append(report.Changes, changeReport{c.record, c.field, c.old, c.new})
+	}
+
+	for _, rType := range cp.RecordTypes() {
+		if modified[rType] == nil {
+			continue
+		}
+
+		report.RecordTypes = append(report.RecordTypes, typeReport{
+			Type:     rType,
+			Modified: len(modified[rType]),
+			Total:    len(cp.Records(rType)),
+		})
+	}
+
+	if e.report == "json" {
+		bytes, err := json.MarshalIndent(report, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bytes))
+		return nil
+	}
+
+	if len(report.RecordTypes) == 0 {
+		fmt.Println("No records modified")
+	}
+	for _, t := range report.RecordTypes {
+		fmt.Printf("Modified %d of %d %s\n", t.Modified, t.Total, t.Type)
+	}
+
+	return nil
+}
+
+// saveFile calls write to overwrite filename, backing it up first.
+// write must replace filename atomically, as SaveAs does.
+func (e *editor) saveFile(filename string, write func(filename string) error) error {
+	if !e.backup {
+		return write(filename)
+	}
+
+	backupName, err := backupFile(filename)
+	if err != nil {
+		return err
+	}
+
+	err = write(filename)
+	if err != nil {
+		if backupName != "" {
+			errorf("the previous contents of %s are in %s\n", filename, backupName)
+		}
+		return err
+	}
+
+	if backupName != "" && !e.keepBackup {
+		return os.Remove(backupName)
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// A fieldPath names a record type, and optionally a record of that type
+// and one of its fields, as in channels, channels[3], channels[3].Name,
+// or zones[Home].ChannelMember.  Record types and fields are matched
+// ignoring case; a record is selected by number or by name.
+type fieldPath struct {
+	rType  codeplug.RecordType
+	record *codeplug.Record
+	fType  codeplug.FieldType
+}
+
+var fieldPathRegexp = regexp.MustCompile(`^(\w+)(?:\[([^\]]+)\])?(?:\.(\w+))?$`)
+
+func parseFieldPath(cp *codeplug.Codeplug, s string) (fieldPath, error) {
+	var path fieldPath
+
+	match := fieldPathRegexp.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return path, fmt.Errorf("bad path: %s", s)
+	}
+
+	for _, rType := range cp.RecordTypes() {
+		if columnKey(string(rType)) == columnKey(match[1]) {
+			path.rType = rType
+		}
+	}
+	if path.rType == "" {
+		return path, fmt.Errorf("unknown record type: %s", match[1])
+	}
+
+	records := cp.Records(path.rType)
+	if match[2] != "" {
+		n, err := strconv.Atoi(match[2])
+		if err == nil {
+			if n-indexBase < 0 || n-indexBase >= len(records) {
+				return path, fmt.Errorf("%s: no record %d", path.rType, n)
+			}
+			path.record = records[n-indexBase]
+		} else {
+			path.record = recordsByName(cp, path.rType)[match[2]]
+			if path.record == nil {
+				return path, fmt.Errorf("%s: no record named %q", path.rType, match[2])
+			}
+		}
+	} else if len(records) == 1 {
+		path.record = records[0]
+	}
+
+	if match[3] != "" {
+		if path.record == nil {
+			return path, fmt.Errorf("%s: a record must be selected", s)
+		}
+		for _, fType := range path.record.FieldTypes() {
+			if columnKey(string(fType)) == columnKey(match[3]) {
+				path.fType = fType
+			}
+		}
+		if path.fType == "" {
+			return path, fmt.Errorf("%s: unknown field: %s", path.rType, match[3])
+		}
+	}
+
+	return path, nil
+}
+
+func printRecord(r *codeplug.Record) {
+	fmt.Printf("%s\n", recordName(r))
+	for _, fType := range r.FieldTypes() {
+		fmt.Printf("\t%s: %s\n", fType, strings.Join(fieldValues(r, fType), ", "))
+	}
+}
+
+// exploreCommand runs one command of the explore subcommand.
+func exploreCommand(cp *codeplug.Codeplug, line string) error {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return nil
+	}
+
+	switch words[0] {
+	case "help", "?":
+		fmt.Println("ls                        list the record types")
+		fmt.Println("ls <type>                 list the records of a type")
+		fmt.Println("show <type>[<n>]          show the fields of a record")
+		fmt.Println("get <type>[<n>].<field>   show the value of a field")
+		fmt.Println("quit                      leave explore")
+		fmt.Println("A record may be selected by name, as in zones[Home].")
+		return nil
+
+	case "ls":
+		if len(words) == 1 {
+			for _, rType := range cp.RecordTypes() {
+				fmt.Printf("%-20s %d records\n", rType, len(cp.Records(rType)))
+			}
+			return nil
+		}
+
+		path, err := parseFieldPath(cp, strings.Join(words[1:], " "))
+		if err != nil {
+			return err
+		}
+		for _, r := range cp.Records(path.rType) {
+			fmt.Printf("%4d %s\n", recordNumber(r), r.Name())
+		}
+		return nil
+
+	case "show", "get":
+		if len(words) < 2 {
+			return fmt.Errorf("usage: %s <path>", words[0])
+		}
+
+		path, err := parseFieldPath(cp, strings.Join(words[1:], " "))
+		if err != nil {
+			return err
+		}
+		if path.record == nil {
+			return errors.New("a record must be selected, as in channels[1]")
+		}
+		if path.fType == "" {
+			printRecord(path.record)
+			return nil
+		}
+		for _, value := range fieldValues(path.record, path.fType) {
+			fmt.Println(value)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown command: %s, try help", words[0])
+}
+
+func explore() error {
+	flags := flag.NewFlagSet("explore", flag.ExitOnError)
+	addIndexBaseFlag(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nReads commands that list and show the records and fields of\n")
+		errorf("<codeplugFilename>, such as \"ls channels\", \"show channels[3]\", and\n")
+		errorf("\"get channels[3].RxFrequency\".  Type help for the full list.\n")
+		errorf("The codeplug is not modified.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
+	filename := args[0]
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	interactive := isTerminal(os.Stdin)
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		if interactive {
+			fmt.Print("> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "quit" || line == "exit" {
+			break
+		}
+
+		err := exploreCommand(cp, line)
+		if err != nil {
+			errorf("%s\n", err.Error())
+		}
+	}
+	if interactive {
+		fmt.Println()
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,279 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// The SPI flash of the supported radios is 16 MiB.
+const spiFlashSize = 16 * 1024 * 1024
+
+// bytesPerExportedField is a generous estimate of the space each field
+// occupies in a text, JSON, or spreadsheet export.
+const bytesPerExportedField = 64
+
+func copyFile(srcName string, dstName string) (err error) {
+	src, err := os.Open(srcName)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(dstName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		cerr := dst.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// backupFile copies filename to filename.bak before it is overwritten
+// in place.  It returns the name of the backup, or "" if filename
+// does not yet exist.
+func backupFile(filename string) (string, error) {
+	_, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	backupName := filename + ".bak"
+	err = copyFile(filename, backupName)
+	if err != nil {
+		return "", err
+	}
+
+	return backupName, nil
+}
+
+// writeFileAtomically calls write to create a temporary file in the
+// same directory as filename and then renames the temporary file to
+// filename.  If the write fails, filename is left untouched, so a
+// partially written file is never visible.
+func writeFileAtomically(filename string, write func(tmpName string) error) (err error) {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+
+	mode := os.FileMode(0644)
+	info, err := os.Stat(filename)
+	if err == nil {
+		mode = info.Mode()
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+base+".*"+filepath.Ext(base))
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	tmp.Close()
+
+	defer func() {
+		if err != nil {
+			os.Remove(tmpName)
+		}
+	}()
+
+	err = write(tmpName)
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmpName, mode)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpName, filename)
+}
+
+// createFileAtomically is like writeFileAtomically, but passes write
+// the open temporary file.
+func createFileAtomically(filename string, write func(w io.Writer) error) error {
+	return writeFileAtomically(filename, func(tmpName string) (err error) {
+		file, err := os.Create(tmpName)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			cerr := file.Close()
+			if err == nil {
+				err = cerr
+			}
+		}()
+
+		return write(file)
+	})
+}
+
+// checkDiskSpace returns an error if the filesystem that will hold
+// filename has less than size bytes available.  If the available
+// space cannot be determined, no error is returned.
+func checkDiskSpace(filename string, size uint64) error {
+	dir := filepath.Dir(filename)
+
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		return nil
+	}
+
+	if free < size {
+		return fmt.Errorf("not enough disk space for %s: need %d bytes, %d available", filename, size, free)
+	}
+
+	return nil
+}
+
+func estimateExportSize(cp *codeplug.Codeplug) uint64 {
+	fields := 0
+	for _, rType := range cp.RecordTypes() {
+		for _, r := range cp.Records(rType) {
+			for _, fType := range r.FieldTypes() {
+				fields += len(r.Fields(fType))
+			}
+		}
+	}
+
+	return uint64(fields * bytesPerExportedField)
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// isGzipFile reports whether filename holds gzip-compressed data,
+// judged by its magic bytes rather than its extension.
+func isGzipFile(filename string) (bool, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	magic, err := bufio.NewReader(file).Peek(len(gzipMagic))
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(magic, gzipMagic), nil
+}
+
+// gunzipFile decompresses filename into a new temporary file and
+// returns its name.  The caller must remove the file.
+func gunzipFile(filename string) (tmpName string, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", filename, err.Error())
+	}
+	defer zr.Close()
+
+	tmp, err := ioutil.TempFile("", "gunzip.*"+filepath.Ext(strings.TrimSuffix(filename, ".gz")))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		cerr := tmp.Close()
+		if err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = io.Copy(tmp, zr)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	return tmp.Name(), nil
+}
+
+// uncompressed returns the name of a file holding the contents of
+// filename, decompressing it first if it is gzip-compressed.  The
+// returned function removes any temporary file and must be called.
+func uncompressed(filename string) (string, func(), error) {
+	gz, err := isGzipFile(filename)
+	if err != nil || !gz {
+		return filename, func() {}, err
+	}
+
+	tmpName, err := gunzipFile(filename)
+	if err != nil {
+		return "", func() {}, err
+	}
+
+	return tmpName, func() { os.Remove(tmpName) }, nil
+}
+
+// gzipFile compresses filename in place.
+func gzipFile(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	return createFileAtomically(filename, func(w io.Writer) error {
+		zw := gzip.NewWriter(w)
+		_, err := zw.Write(data)
+		if err != nil {
+			return err
+		}
+
+		return zw.Close()
+	})
+}
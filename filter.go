@@ -0,0 +1,300 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A filter is a parsed filter expression, such as
+//
+//	country == "United States" && (state == California || callsign =~ "^ZL")
+//
+// Comparisons are ==, !=, <, <=, >, >=, and =~ (regular expression
+// match).  Values are compared as numbers when both sides are numbers
+// and otherwise as strings, ignoring case.  A value may be quoted, and
+// must be if it contains spaces or operators.  Comparisons combine with
+// &&, ||, !, and parentheses.
+type filter interface {
+	match(value func(field string) string) bool
+}
+
+type andFilter struct{ a, b filter }
+type orFilter struct{ a, b filter }
+type notFilter struct{ a filter }
+
+type compareFilter struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (f andFilter) match(value func(string) string) bool {
+	return f.a.match(value) && f.b.match(value)
+}
+
+func (f orFilter) match(value func(string) string) bool {
+	return f.a.match(value) || f.b.match(value)
+}
+
+func (f notFilter) match(value func(string) string) bool {
+	return !f.a.match(value)
+}
+
+func (f compareFilter) match(value func(string) string) bool {
+	v := value(f.field)
+	if f.re != nil {
+		return f.re.MatchString(v)
+	}
+
+	x, errA := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	y, errB := strconv.ParseFloat(f.value, 64)
+	cmp := 0
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(strings.ToLower(v), strings.ToLower(f.value))
+	}
+
+	switch f.op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+var filterOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "<", ">", "!", "(", ")"}
+
+func tokenizeFilter(s string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+			continue
+
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, s[i:j+1])
+			i = j + 1
+			continue
+		}
+
+		op := ""
+		for _, o := range filterOperators {
+			if strings.HasPrefix(s[i:], o) {
+				op = o
+				break
+			}
+		}
+		if op != "" {
+			tokens = append(tokens, op)
+			i += len(op)
+			continue
+		}
+
+		j := i
+		for j < len(s) && !unicode.IsSpace(rune(s[j])) && !strings.ContainsRune("&|=!<>()\"", rune(s[j])) {
+			j++
+		}
+		if j == i {
+			return nil, fmt.Errorf("unexpected %q", s[i:i+1])
+		}
+		tokens = append(tokens, s[i:j])
+		i = j
+	}
+
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []string
+	fields map[string]string
+}
+
+func (p *filterParser) peek() string {
+	if len(p.tokens) == 0 {
+		return ""
+	}
+	return p.tokens[0]
+}
+
+func (p *filterParser) next() string {
+	t := p.peek()
+	if len(p.tokens) != 0 {
+		p.tokens = p.tokens[1:]
+	}
+	return t
+}
+
+func (p *filterParser) or() (filter, error) {
+	a, err := p.and()
+	for err == nil && p.peek() == "||" {
+		p.next()
+		var b filter
+		b, err = p.and()
+		a = orFilter{a, b}
+	}
+	return a, err
+}
+
+func (p *filterParser) and() (filter, error) {
+	a, err := p.not()
+	for err == nil && p.peek() == "&&" {
+		p.next()
+		var b filter
+		b, err = p.not()
+		a = andFilter{a, b}
+	}
+	return a, err
+}
+
+func (p *filterParser) not() (filter, error) {
+	switch p.peek() {
+	case "!":
+		p.next()
+		a, err := p.not()
+		return notFilter{a}, err
+
+	case "(":
+		p.next()
+		a, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing )")
+		}
+		return a, nil
+	}
+
+	return p.compare()
+}
+
+func (p *filterParser) compare() (filter, error) {
+	name := p.next()
+	field, ok := p.fields[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", name)
+	}
+
+	op := p.next()
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "=~":
+	default:
+		return nil, fmt.Errorf("expected a comparison after %s", name)
+	}
+
+	value := p.next()
+	if value == "" {
+		return nil, fmt.Errorf("expected a value after %s %s", name, op)
+	}
+	if strings.HasPrefix(value, "\"") {
+		var err error
+		value, err = strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("bad string %s", value)
+		}
+	}
+
+	f := compareFilter{field: field, op: op, value: value}
+	if op == "=~" {
+		re, err := regexp.Compile("(?i)" + value)
+		if err != nil {
+			return nil, err
+		}
+		f.re = re
+	}
+
+	return f, nil
+}
+
+// printFilterUsage describes filter expressions over fields.
+func printFilterUsage(fields []string) {
+	errorf("\nA -filter expression compares fields with ==, !=, <, <=, >, >=, or\n")
+	errorf("=~ (regular expression match), and combines comparisons with &&,\n")
+	errorf("||, !, and parentheses.  Numbers are compared as numbers, and other\n")
+	errorf("values as strings ignoring case.  Quote values containing spaces.\n")
+	errorf("For example: 'country == \"United States\" && state == California'\n")
+	if fields != nil {
+		errorf("The fields are: %s\n", strings.Join(fields, ", "))
+	}
+}
+
+// parseFilter parses a filter expression over the given field names,
+// which are matched ignoring case.
+func parseFilter(s string, fields []string) (filter, error) {
+	tokens, err := tokenizeFilter(s)
+	if err != nil {
+		return nil, fmt.Errorf("bad filter: %s", err.Error())
+	}
+
+	p := &filterParser{
+		tokens: tokens,
+		fields: make(map[string]string),
+	}
+	for _, field := range fields {
+		p.fields[strings.ToLower(field)] = field
+	}
+
+	f, err := p.or()
+	if err == nil && len(p.tokens) != 0 {
+		err = fmt.Errorf("unexpected %q", p.peek())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad filter: %s", err.Error())
+	}
+
+	return f, nil
+}
@@ -6,13 +6,13 @@ require (
 	github.com/dalefarnsworth-dmr/codeplug v1.0.27
 	github.com/dalefarnsworth-dmr/debug v1.0.20
 	github.com/dalefarnsworth-dmr/dfu v1.0.20
-	github.com/dalefarnsworth-dmr/stdfu v1.0.20 // indirect
+	github.com/dalefarnsworth-dmr/stdfu v1.0.20
 	github.com/dalefarnsworth-dmr/userdb v1.0.29
 	github.com/frankban/quicktest v1.14.0 // indirect
 	github.com/google/btree v1.0.1 // indirect
 	github.com/kr/text v0.2.0 // indirect
 	github.com/shabbyrobe/xmlwriter v0.0.0-20210324110748-440e98cf0c87 // indirect
-	github.com/tealeg/xlsx/v3 v3.2.3 // indirect
+	github.com/tealeg/xlsx/v3 v3.2.3
 	golang.org/x/build v0.0.0-20200402160453-61705b562fc9 // indirect
 	golang.org/x/crypto v0.0.0-20200323165209-0ec3e9974c59 // indirect
 	golang.org/x/net v0.0.0-20200324143707-d3edc9973b7e // indirect
@@ -0,0 +1,278 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// A region is a range of bytes of a codeplug file backing a record or
+// a field.  Fields smaller than a byte occupy bits of their first byte.
+type region struct {
+	name      string
+	offset    int
+	size      int
+	bitOffset int
+	bitSize   int
+}
+
+// The codeplug package does not export where its records and fields
+// live in the file, so their layout is read from the unexported fields
+// of its CodeplugInfo by reflection, using the names of codeplug
+// v1.0.27.  Offsets are into the bytes of an rdt file.
+
+func layoutInt(v reflect.Value, name string) int {
+	return int(v.FieldByName(name).Int())
+}
+
+// recordLayout returns the recordInfo of cp for the record type named
+// name, matched as CSV record types are.
+func recordLayout(cp *codeplug.Codeplug, name string) (reflect.Value, error) {
+	infos := reflect.ValueOf(cp.CodeplugInfo().RecordInfos)
+	for i := 0; i < infos.Len(); i++ {
+		ri := infos.Index(i).Elem()
+		if columnKey(ri.FieldByName("rType").String()) == columnKey(name) {
+			return ri, nil
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("no record type %q", name)
+}
+
+// fieldLayout returns the fieldInfo of ri for the field type named name.
+func fieldLayout(ri reflect.Value, name string) (reflect.Value, error) {
+	infos := ri.FieldByName("fieldInfos")
+	for i := 0; i < infos.Len(); i++ {
+		fi := infos.Index(i).Elem()
+		if columnKey(fi.FieldByName("fType").String()) == columnKey(name) {
+			return fi, nil
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("%s: no field %q", ri.FieldByName("rType").String(), name)
+}
+
+// recordRegions returns the region of the record at slot of record type
+// ri, or, if field is not "", the regions of each of that field's
+// values within it.
+func recordRegions(ri reflect.Value, slot int, field string) ([]region, error) {
+	rType := ri.FieldByName("rType").String()
+	max := layoutInt(ri, "max")
+	if max == 0 {
+		max = 1
+	}
+	if slot < 0 || slot >= max {
+		return nil, fmt.Errorf("%s: no record %d, there are %d", rType, slot+indexBase, max)
+	}
+
+	recordOffset := layoutInt(ri, "offset") + slot*layoutInt(ri, "size")
+	name := fmt.Sprintf("%s %d", rType, slot+indexBase)
+	if field == "" {
+		return []region{{name, recordOffset, layoutInt(ri, "size"), 0, 0}}, nil
+	}
+
+	fi, err := fieldLayout(ri, field)
+	if err != nil {
+		return nil, err
+	}
+
+	fType := fi.FieldByName("fType").String()
+	bitOffset := layoutInt(fi, "bitOffset")
+	bitSize := layoutInt(fi, "bitSize")
+	size := (bitSize + 7) / 8
+	extSize := layoutInt(fi, "extSize")
+	extIndex := layoutInt(fi, "extIndex")
+	fMax := layoutInt(fi, "max")
+	if fMax == 0 {
+		fMax = 1
+	}
+
+	var regions []region
+	for i := 0; i < fMax; i++ {
+		fName := name + " " + fType
+		if fMax > 1 {
+			fName = fmt.Sprintf("%s[%d]", fName, i+indexBase)
+		}
+
+		if extSize != 0 && i >= extIndex {
+			offset := layoutInt(fi, "extOffset") + slot*extSize +
+				layoutInt(fi, "extBitOffset")/8 + (i-extIndex)*size
+			regions = append(regions, region{fName, offset, size, 0, bitSize})
+			continue
+		}
+
+		bit := bitOffset + i*bitSize
+		regions = append(regions, region{fName, recordOffset + bit/8, size, bit % 8, bitSize})
+	}
+
+	return regions, nil
+}
+
+// fileOffset returns the offset in a file of size fileSize of offset,
+// an offset into the rdt bytes of a codeplug described by cpi.  Bin
+// files omit the rdt header and trailer.
+func fileOffset(cpi *codeplug.CodeplugInfo, fileSize int, offset int) (int, error) {
+	switch fileSize {
+	case cpi.RdtSize:
+		return offset, nil
+	case cpi.RdtSize - cpi.HeaderSize - cpi.TrailerSize:
+		switch {
+		case offset < cpi.HeaderSize:
+			return 0, fmt.Errorf("offset %#x is in the rdt header, which bin files omit", offset)
+		case offset < cpi.TrailerOffset:
+			return offset - cpi.HeaderSize, nil
+		case offset < cpi.TrailerOffset+cpi.TrailerSize:
+			return 0, fmt.Errorf("offset %#x is in the rdt trailer, which bin files omit", offset)
+		}
+		return offset - cpi.HeaderSize - cpi.TrailerSize, nil
+	}
+
+	return 0, fmt.Errorf("file size %#x is not that of a %s rdt or bin file", fileSize, cpi.Type)
+}
+
+func hexdump() error {
+	var offset int
+	var length int
+	var recordType string
+	var index int
+	var field string
+
+	flags := flag.NewFlagSet("hexdump", flag.ExitOnError)
+	flags.IntVar(&offset, "offset", 0, "byte offset of the first byte to dump")
+	flags.IntVar(&length, "length", 0, "number of bytes to dump (default: to the end of the file)")
+	flags.StringVar(&recordType, "record", "", "record type whose bytes to dump, instead of -offset and -length")
+	flags.IntVar(&index, "index", -1, "number of the record, counted from -base (default: the first)")
+	flags.StringVar(&field, "field", "", "field of the record whose bytes to dump")
+	addIndexBaseFlag(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s [-offset <offset>] [-length <length>] <codeplugFilename>\n", os.Args[0], os.Args[1])
+		errorf("       %s %s -record <recordType> [-index <n>] [-field <fieldName>] <codeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nPrints the offset, hex, and ASCII of the raw bytes of <codeplugFilename>.\n")
+		errorf("Offsets may be given in decimal or, with a 0x prefix, in hex.\n")
+		errorf("With -record, the bytes of the record numbered -index are printed,\n")
+		errorf("or with -field, those of each of its values of that field, after a\n")
+		errorf("line giving the offset and length of each.  For a field smaller\n")
+		errorf("than a byte, the line also gives its bits, counted from the most\n")
+		errorf("significant.  <codeplugFilename> must then be an rdt or bin file.\n")
+		errorf("-index counts record slots in the file, including those of deleted\n")
+		errorf("records.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
+	filename := args[0]
+
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	if recordType == "" {
+		if field != "" {
+			errorf("-field requires -record\n\n")
+			flags.Usage()
+		}
+
+		if offset < 0 || offset > len(bytes) {
+			return fmt.Errorf("offset %#x is outside of %s (size %#x)", offset, filename, len(bytes))
+		}
+
+		end := len(bytes)
+		if length > 0 && offset+length < end {
+			end = offset + length
+		}
+
+		dumpBytes(bytes, offset, end)
+		return nil
+	}
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	if index < 0 {
+		index = indexBase
+	}
+
+	ri, err := recordLayout(cp, recordType)
+	if err != nil {
+		return fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	regions, err := recordRegions(ri, index-indexBase, field)
+	if err != nil {
+		return fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	for _, reg := range regions {
+		start, err := fileOffset(cp.CodeplugInfo(), len(bytes), reg.offset)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %s", filename, reg.name, err.Error())
+		}
+
+		fmt.Printf("%s: offset %#x, length %d", reg.name, start, reg.size)
+		if reg.bitSize%8 != 0 {
+			fmt.Printf(", bits %d-%d", reg.bitOffset, reg.bitOffset+reg.bitSize-1)
+		}
+		fmt.Println()
+		dumpBytes(bytes, start, start+reg.size)
+	}
+
+	return nil
+}
+
+// dumpBytes prints the offset, hex, and ASCII of bytes[start:end],
+// 16 bytes per line.
+func dumpBytes(bytes []byte, start int, end int) {
+	for i := start; i < end; i += 16 {
+		lineEnd := i + 16
+		if lineEnd > end {
+			lineEnd = end
+		}
+		line := bytes[i:lineEnd]
+
+		ascii := make([]byte, len(line))
+		for j, b := range line {
+			ascii[j] = '.'
+			if b >= ' ' && b <= '~' {
+				ascii[j] = b
+			}
+		}
+
+		fmt.Printf("%08x  %-47s  |%s|\n", i, fmt.Sprintf("% x", line), ascii)
+	}
+}
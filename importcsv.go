@@ -0,0 +1,241 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+	"github.com/dalefarnsworth-dmr/userdb"
+)
+
+// columnKey returns the form of a CSV column or field name used to
+// match the two: lowercase, without spaces, underscores, or hyphens.
+func columnKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '_', '-':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(name)))
+}
+
+// csvColumns maps each column of header to a field type of rType,
+// warning about columns that match no field, or no single-valued field
+// unless multiValued is set.  Unmatched columns map to "".
+func csvColumns(cp *codeplug.Codeplug, rType codeplug.RecordType, header []string, multiValued bool) ([]codeplug.FieldType, error) {
+	// NewField describes each field type to r, which MaxFields
+	// needs, even for types r has no fields of.
+	r := newRecord(cp, rType)
+	fTypes := make(map[string]codeplug.FieldType)
+	for _, fType := range r.AllFieldTypes() {
+		r.NewField(fType)
+		fTypes[columnKey(string(fType))] = fType
+	}
+
+	columns := make([]codeplug.FieldType, len(header))
+	hasName := false
+	for i, name := range header {
+		if name == numberColumn {
+			continue
+		}
+		fType, ok := fTypes[columnKey(name)]
+		if !ok {
+			err := warnf("ignoring unknown %s column %q", rType, name)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if r.MaxFields(fType) > 1 && !multiValued {
+			err := warnf("ignoring column %q, %s may have more than one value", name, fType)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if fType == ftName {
+			hasName = true
+		}
+		columns[i] = fType
+	}
+
+	if !hasName {
+		return nil, fmt.Errorf("no %s column", ftName)
+	}
+
+	return columns, nil
+}
+
+func importCSV() error {
+	rTypeName := string(rtChannels)
+	var preserveOrder bool
+	var ed editor
+
+	flags := flag.NewFlagSet("importCSV", flag.ExitOnError)
+	flags.StringVar(&rTypeName, "type", rTypeName, "type of the records in the CSV file, Channels or Contacts")
+	flags.BoolVar(&preserveOrder, "preserve-order", false, "move the imported records to the start, in the order of the CSV rows")
+	ed.addFlags(flags)
+	addProgressFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s [-type <recordType>] <codeplugFilename> <csvFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nAdds or updates a record in <codeplugFilename> for each row of\n")
+		errorf("<csvFilename>.  The first row names the columns, which may be in\n")
+		errorf("any order.  Column names are matched to field names ignoring\n")
+		errorf("case, spaces, and underscores.  A Name column is required; unknown\n")
+		errorf("columns are ignored with a warning and missing columns or empty\n")
+		errorf("cells leave the field at its existing or default value.\n")
+		errorf("New records are added after the existing ones.  With -preserve-order,\n")
+		errorf("the imported records are moved to the start, in the order of their\n")
+		errorf("rows, so that their record numbers match the CSV file.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 2 {
+		flags.Usage()
+	}
+	filename := args[0]
+	csvFilename := args[1]
+
+	var rType codeplug.RecordType
+	switch columnKey(rTypeName) {
+	case columnKey(string(rtChannels)):
+		rType = rtChannels
+	case columnKey(string(rtContacts)):
+		rType = rtContacts
+	default:
+		errorf("bad record type: %s\n\n", rTypeName)
+		flags.Usage()
+	}
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(csvFilename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("%s: %s", csvFilename, err.Error())
+	}
+
+	columns, err := csvColumns(cp, rType, header, false)
+	if err != nil {
+		return fmt.Errorf("%s: %s", csvFilename, err.Error())
+	}
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return fmt.Errorf("%s: %s", csvFilename, err.Error())
+	}
+
+	progress := progressCallback([]string{"Importing " + csvFilename})
+	m := merger{ed: &ed, cp: cp}
+	names := recordsByName(cp, rType)
+	var imported []*codeplug.Record
+	seen := make(map[*codeplug.Record]bool)
+	for i, row := range rows {
+		line := i + 2
+		progress(i * userdb.MaxProgress / len(rows))
+
+		values := make(map[codeplug.FieldType]string)
+		for j, value := range row {
+			if j < len(columns) && columns[j] != "" && value != "" {
+				values[columns[j]] = value
+			}
+		}
+
+		name := values[ftName]
+		if name == "" {
+			err = warnf("%s:%d: skipping row without a name", csvFilename, line)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		r := names[name]
+		if r == nil {
+			r, err = m.addRecord(rType, name)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s", csvFilename, line, err.Error())
+			}
+			names[name] = r
+		}
+		if !seen[r] {
+			seen[r] = true
+			imported = append(imported, r)
+		}
+
+		for _, fType := range columns {
+			value, ok := values[fType]
+			if !ok || fType == ftName {
+				continue
+			}
+
+			f := r.Field(fType)
+			if f == nil {
+				err = m.addField(r, fType, value)
+			} else {
+				err = ed.setField(f, value)
+			}
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s", csvFilename, line, err.Error())
+			}
+		}
+	}
+	if len(rows) != 0 {
+		progress(userdb.MaxProgress)
+		fmt.Println()
+	}
+
+	if preserveOrder {
+		for i, r := range imported {
+			if r.Index() != i {
+				ed.record(r, "", "", fmt.Sprintf("moved to %d", i+indexBase))
+				cp.MoveRecord(i, r)
+			}
+		}
+	}
+
+	return ed.save(cp, filename)
+}
@@ -0,0 +1,90 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// capacityWarningPercent is the usage of a record type above which
+// printCodeplugSummary warns.
+const capacityWarningPercent = 95
+
+// printCodeplugSummary prints the model and frequency range of cp and
+// the number of records of each type against its limit, warning about
+// types that are nearly full.
+func printCodeplugSummary(cp *codeplug.Codeplug) error {
+	typ, freqRange := loadedModel(cp)
+	fmt.Printf("Model: %s\n", typ)
+	fmt.Printf("Frequency range: %s\n", freqRange)
+
+	for _, rType := range cp.RecordTypes() {
+		max := cp.MaxRecords(rType)
+		if max <= 1 {
+			continue
+		}
+
+		count := len(cp.Records(rType))
+		percent := count * 100 / max
+		fmt.Printf("%-20s %5d/%-5d (%d%%)\n", rType, count, max, percent)
+		if percent > capacityWarningPercent {
+			err := warnf("%s are %d%% full", rType, percent)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func codeplugInfo() error {
+	flags := flag.NewFlagSet("codeplugInfo", flag.ExitOnError)
+	addStdinFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nPrints the model and frequency range of <codeplugFilename> and the\n")
+		errorf("number of records of each type against the radio's limit.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, args[0])
+	if err != nil {
+		return err
+	}
+
+	return printCodeplugSummary(cp)
+}
@@ -0,0 +1,299 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+func readJSONObject(filename string) (map[string]json.RawMessage, error) {
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj map[string]json.RawMessage
+	err = json.Unmarshal(bytes, &obj)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	return obj, nil
+}
+
+func writeJSONObject(filename string, obj interface{}) error {
+	bytes, err := json.MarshalIndent(obj, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, append(bytes, '\n'), 0644)
+}
+
+// jsonModel returns the model and frequency range recorded in the basic
+// information of the JSON codeplug in filename.  A radio with two bands
+// records each, and they are joined as the codeplug package joins them.
+func jsonModel(filename string) (model string, freqRange string, err error) {
+	obj, err := readJSONObject(filename)
+	if err != nil {
+		return "", "", err
+	}
+
+	var info map[string]interface{}
+	raw, ok := obj[string(rtBasicInfo)]
+	if ok {
+		err = json.Unmarshal(raw, &info)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %s: %s", filename, rtBasicInfo, err.Error())
+		}
+	}
+
+	str := func(name string) string {
+		s, _ := info[name].(string)
+		return s
+	}
+
+	model = str("Model")
+	freqRange = str("FrequencyRange")
+	if freqRange == "" {
+		freqRange = str("FrequencyRangeA")
+		if b := str("FrequencyRangeB"); b != "" {
+			freqRange += "_" + b
+		}
+	}
+
+	return model, freqRange, nil
+}
+
+// jsonCodeplugModel returns the codeplug type and frequency range of cp,
+// loaded from the JSON file filename, as recorded in that file.  Unlike
+// codeplugModel, it does not guess when they are missing or unknown.
+func jsonCodeplugModel(cp *codeplug.Codeplug, filename string, displayName string) (string, string, error) {
+	model, freqRange, err := jsonModel(filename)
+	if err != nil {
+		return "", "", err
+	}
+	if model == "" || freqRange == "" {
+		return "", "", fmt.Errorf("%s: no model and frequency range in %s", displayName, rtBasicInfo)
+	}
+
+	types, freqs := cp.TypesFrequencyRanges()
+	if len(types) != 1 || len(freqs[types[0]]) != 1 {
+		return "", "", fmt.Errorf("%s: unknown model %s with frequency range %s", displayName, model, freqRange)
+	}
+
+	return types[0], freqs[types[0]][0], nil
+}
+
+func checkRecordTypes(cp *codeplug.Codeplug, names []string) error {
+	valid := make(map[string]bool)
+	for _, rType := range cp.RecordTypes() {
+		valid[string(rType)] = true
+	}
+
+	for _, name := range names {
+		if !valid[name] {
+			return fmt.Errorf("unknown record type: %s", name)
+		}
+	}
+
+	return nil
+}
+
+// filterJSONRecordTypes rewrites the JSON codeplug in filename so that
+// it contains only the record types in keep.  Members that do not name
+// a record type are retained, as is the basic information, which
+// records the model and frequency range.
+func filterJSONRecordTypes(filename string, cp *codeplug.Codeplug, keep []string) error {
+	obj, err := readJSONObject(filename)
+	if err != nil {
+		return err
+	}
+
+	kept := map[string]bool{
+		string(rtBasicInfo): true,
+	}
+	for _, name := range keep {
+		kept[name] = true
+	}
+
+	for _, rType := range cp.RecordTypes() {
+		if !kept[string(rType)] {
+			delete(obj, string(rType))
+		}
+	}
+
+	return writeJSONObject(filename, obj)
+}
+
+// The members of an exported JSON codeplug that are not record types
+// are written to this file by codeplugToJSONDir.
+const jsonDirCodeplugFile = "codeplug.json"
+
+func codeplugToJSONDir() error {
+	flags := flag.NewFlagSet("codeplugToJSONDir", flag.ExitOnError)
+	addStdinFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFilename> <dirname>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nWrites a JSON representation of the codeplug in <codeplugFilename>\n")
+		errorf("into <dirname>, one file per record type (channels.json, contacts.json,\n")
+		errorf("etc.), plus %s for the remaining members.\n", jsonDirCodeplugFile)
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 2 {
+		flags.Usage()
+	}
+	codeplugFilename := args[0]
+	dirname := args[1]
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, codeplugFilename)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dirname, 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dirname, ".codeplug.*.json")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpName)
+
+	err = cp.ExportJSON(tmpName)
+	if err != nil {
+		return err
+	}
+
+	obj, err := readJSONObject(tmpName)
+	if err != nil {
+		return err
+	}
+
+	for _, rType := range cp.RecordTypes() {
+		name := string(rType)
+		value, ok := obj[name]
+		if !ok {
+			continue
+		}
+		delete(obj, name)
+
+		filename := filepath.Join(dirname, strings.ToLower(name)+".json")
+		err = writeFileAtomically(filename, func(tmpName string) error {
+			return writeJSONObject(tmpName, map[string]json.RawMessage{name: value})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	filename := filepath.Join(dirname, jsonDirCodeplugFile)
+	return writeFileAtomically(filename, func(tmpName string) error {
+		return writeJSONObject(tmpName, obj)
+	})
+}
+
+func jsonDirToCodeplug() error {
+	flags := flag.NewFlagSet("jsonDirToCodeplug", flag.ExitOnError)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <dirname> <codeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nCreates a codeplug file, <codeplugFilename>, from the JSON files\n")
+		errorf("in <dirname>, as written by codeplugToJSONDir.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 2 {
+		flags.Usage()
+	}
+	dirname := args[0]
+	codeplugFilename := args[1]
+
+	filenames, err := filepath.Glob(filepath.Join(dirname, "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(filenames) == 0 {
+		return fmt.Errorf("%s: no JSON files found", dirname)
+	}
+
+	merged := make(map[string]json.RawMessage)
+	for _, filename := range filenames {
+		if strings.HasPrefix(filepath.Base(filename), ".") {
+			continue
+		}
+
+		obj, err := readJSONObject(filename)
+		if err != nil {
+			return err
+		}
+
+		for name, value := range obj {
+			if _, ok := merged[name]; ok {
+				return fmt.Errorf("%s: %s is also defined in another file", filename, name)
+			}
+			merged[name] = value
+		}
+	}
+
+	tmp, err := ioutil.TempFile("", "codeplug.*.json")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpName)
+
+	err = writeJSONObject(tmpName, merged)
+	if err != nil {
+		return err
+	}
+
+	cp, err := loadCodeplug(codeplug.FileTypeJSON, tmpName)
+	if err != nil {
+		return err
+	}
+
+	return cp.SaveAs(codeplugFilename)
+}
@@ -0,0 +1,220 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// A repeater is a location read from a repeater database.
+type repeater struct {
+	freq      float64
+	callsign  string
+	latitude  float64
+	longitude float64
+}
+
+// readRepeaters reads a CSV repeater database.  Its first row names the
+// columns, which must include Frequency (the output frequency in MHz),
+// Latitude, and Longitude, and may include Callsign.
+func readRepeaters(filename string) ([]repeater, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[columnKey(name)] = i
+	}
+	for _, name := range []string{"frequency", "latitude", "longitude"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%s: no %s column", filename, name)
+		}
+	}
+
+	var repeaters []repeater
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err.Error())
+		}
+
+		cell := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+
+		var r repeater
+		var err1, err2, err3 error
+		r.freq, err1 = strconv.ParseFloat(cell("frequency"), 64)
+		r.latitude, err2 = strconv.ParseFloat(cell("latitude"), 64)
+		r.longitude, err3 = strconv.ParseFloat(cell("longitude"), 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			err := warnf("%s:%d: skipping row with a bad frequency or location", filename, line)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		r.callsign = strings.ToUpper(cell("callsign"))
+
+		repeaters = append(repeaters, r)
+	}
+
+	return repeaters, nil
+}
+
+// findRepeater returns the repeater transmitting on the receive
+// frequency of channel r, preferring one whose callsign is in the
+// channel's name, or nil if there is none.
+func findRepeater(r *codeplug.Record, repeaters []repeater) *repeater {
+	f := r.Field(ftRxFrequency)
+	if f == nil {
+		return nil
+	}
+	freq, err := strconv.ParseFloat(f.String(), 64)
+	if err != nil {
+		return nil
+	}
+
+	name := strings.ToUpper(r.Name())
+	var found *repeater
+	for i := range repeaters {
+		rpt := &repeaters[i]
+		if rpt.freq < freq-0.0005 || rpt.freq > freq+0.0005 {
+			continue
+		}
+		if rpt.callsign != "" && strings.Contains(name, rpt.callsign) {
+			return rpt
+		}
+		if found == nil {
+			found = rpt
+		}
+	}
+
+	return found
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func channelsToKML() error {
+	var repeaterDB string
+
+	flags := flag.NewFlagSet("channelsToKML", flag.ExitOnError)
+	flags.StringVar(&repeaterDB, "repeater-db", "", "CSV file of repeater locations")
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s -repeater-db <csvFile> <codeplugFilename> <kmlFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nWrites a KML file with a placemark for each channel in\n")
+		errorf("<codeplugFilename> whose location can be found.  Codeplugs do not\n")
+		errorf("hold locations, so channels are located by looking up their receive\n")
+		errorf("frequency in the repeater database, preferring a repeater whose\n")
+		errorf("callsign is in the channel name.  The first row of the database\n")
+		errorf("names its columns: Frequency (MHz), Latitude, Longitude, and\n")
+		errorf("optionally Callsign.  Channels without a location are skipped.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 2 || repeaterDB == "" {
+		flags.Usage()
+	}
+	filename := args[0]
+	kmlFilename := args[1]
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	repeaters, err := readRepeaters(repeaterDB)
+	if err != nil {
+		return err
+	}
+
+	placed := 0
+	skipped := 0
+	err = createFileAtomically(kmlFilename, func(file io.Writer) error {
+		fmt.Fprintf(file, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+		fmt.Fprintf(file, "<kml xmlns=\"http://www.opengis.net/kml/2.2\">\n")
+		fmt.Fprintf(file, "<Document>\n<name>%s</name>\n", xmlEscape(filename))
+
+		for _, r := range cp.Records(rtChannels) {
+			rpt := findRepeater(r, repeaters)
+			if rpt == nil {
+				skipped++
+				continue
+			}
+
+			fmt.Fprintf(file, "<Placemark>\n")
+			fmt.Fprintf(file, "\t<name>%s</name>\n", xmlEscape(r.Name()))
+			fmt.Fprintf(file, "\t<description>%s MHz %s</description>\n",
+				xmlEscape(r.Field(ftRxFrequency).String()), xmlEscape(rpt.callsign))
+			fmt.Fprintf(file, "\t<Point><coordinates>%f,%f</coordinates></Point>\n", rpt.longitude, rpt.latitude)
+			fmt.Fprintf(file, "</Placemark>\n")
+			placed++
+		}
+
+		_, err := fmt.Fprintf(file, "</Document>\n</kml>\n")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d channels placed, %d skipped without a location\n", placed, skipped)
+	return nil
+}
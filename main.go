@@ -25,18 +25,26 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	rtdebug "runtime/debug"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dalefarnsworth-dmr/codeplug"
-	"github.com/dalefarnsworth-dmr/debug"
 	"github.com/dalefarnsworth-dmr/dfu"
+	"github.com/dalefarnsworth-dmr/stdfu"
 	"github.com/dalefarnsworth-dmr/userdb"
 )
 
@@ -46,31 +54,76 @@ func errorf(s string, v ...interface{}) {
 
 func usage() {
 	subCommandUsages := []string{
+		"applyOverlay <baseCodeplugFile> <overlayJSONFile> <outCodeplugFile>",
+		"batchConvert -to <format> [-skip-existing [-force]] <outDir> <inFile>...",
+		"channelsToKML -repeater-db <csvFile> <codeplugFile> <kmlFile>",
+		"checkReferences <codeplugFile>",
+		"checkRoundTrip [-formats <formats>] <codeplugFile>",
+		"codeplugInfo <codeplugFile>",
+		"codeplugToCSV <codeplugFile> <recordType> <csvFile>",
 		"codeplugToJSON <codeplugFile> <jsonFile>",
+		"codeplugToJSONDir <codeplugFile> <dir>",
 		"codeplugToText <codeplugFile> <textFile>",
 		"codeplugToXLSX <codeplugFile> <xlsxFile>",
+		"compareModels <modelA> <modelB>",
 		"countryCounts <usersFile>",
+		"csvToCodeplug <codeplugFile> <recordType> <csvFile>",
+		"dedupeZones <codeplugFile>",
+		"diffCodeplugs [-stats] <codeplugFileA> <codeplugFileB>",
+		"diffDefaults [-stats] <codeplugFile>",
+		"explore <codeplugFile>",
+		"exportCountriesTemplate <usersFile> <countriesFile>",
+		"exportTemplate -model <model> -freq <freqRange> -format <format> <file>",
+		"fieldInfo -model <model> -freq <freqRange>",
 		"filterUsers <countriesFile> <inUsersFile> <outUsersFile>",
+		"frequencyRanges [-model <model>]",
+		"generateContacts [-users <usersFile>] <codeplugFile>",
 		"getMergedUsers <usersFile>",
 		"getAbbreviatedUsers <usersFile>",
 		"getUsers <usersFile>",
+		"hexdump [-offset <offset>] [-length <length>] <codeplugFile>",
+		"hexdump -record <recordType> [-index <n>] [-field <field>] <codeplugFile>",
+		"importCSV [-type <recordType>] <codeplugFile> <csvFile>",
+		"jsonDirToCodeplug <dir> <codeplugFile>",
+		"jsonSchema -model <model> -freq <freqRange>",
 		"jsonToCodeplug <jsonFile> <codeplugFile>",
+		"listCountryAliases",
+		"listModels [-pretty]",
+		"listScanLists [-json] <codeplugFile>",
+		"listTalkgroups [-channels] [-json] <codeplugFile>",
+		"mergeCodeplugs <baseCodeplugFile> <codeplugFile> <outCodeplugFile>",
+		"modelMatrix [-format markdown|csv] [-fields]",
 		"newCodeplug -model <model> -freq <freqRange> <codeplugFile>",
 		"readCodeplug -model <model> -freq <freqRange> <codeplugFile>",
+		"readCodeplugToJSON -model <model> -freq <freqRange> <jsonFile>",
+		"readCodeplugToText -model <model> -freq <freqRange> <textFile>",
+		"readCodeplugToXLSX -model <model> -freq <freqRange> <xlsxFile>",
 		"readMD380Users <usersFile>",
 		"readSPIFlash <filename>",
+		"reindex <codeplugFile>",
+		"sanitizeCodeplug <inCodeplugFile> <outCodeplugFile>",
+		"selftest [-skip-radio] [-url <url>]",
+		"setChannelField [-all | -zone <name> | -freq <band>] <codeplugFile> <field> <value>",
+		"setDMRID [-users <usersFile>] <codeplugFile> <dmrID>",
+		"setScanPriority -priority1 <channel> -priority2 <channel> <codeplugFile> <scanListName>",
+		"sortZoneChannels [-zone <name>] -by <field> <codeplugFile>",
+		"splitZones -max <n> <codeplugFile>",
+		"testConnection",
 		"textToCodeplug <textFile> <codeplugFile>",
 		"userCountries <usersFile> <countriesFile>",
-		"version",
+		"validateCodeplug [-keep-going=false] <codeplugFile>...",
+		"verifySPIFlash [-offset <offset>] <filename>",
+		"version [-json] [-verbose]",
 		"writeCodeplug <codeplugFile>",
 		"writeMD380Firmware <firmwareFile>",
 		"writeMD2017Users <usersFile>",
 		"writeMD380Users <usersFile>",
 		"writeUV380Users <usersFile>",
+		"writeUsers [-model <model>] <usersFile>",
 		"xlsxToCodeplug <xlsxFile> <codeplugFile>",
 	}
 
-	errorf("Usage %s <subCommand> args\n", os.Args[0])
+	errorf("Usage %s [-warnings-as-errors] <subCommand> args\n", os.Args[0])
 	errorf("subCommands:\n")
 
 	for _, s := range subCommandUsages {
@@ -78,7 +131,14 @@ func usage() {
 	}
 
 	errorf("Use '%s <subCommand> -h' for subCommand help\n", os.Args[0])
+	errorf("Use '%s -warnings-as-errors <subCommand> ...' to fail on any warning\n", os.Args[0])
 	errorf("\n\tNote that the capitalization of the <subCommand> is ignored.\n")
+	errorf("\tProgress is shown at most every %v; set %s\n", defaultProgressInterval, progressIntervalEnv)
+	errorf("\tto a duration such as 250ms to change that.\n")
+	errorf("\tA <codeplugFile> of - is read from standard input.\n")
+	errorf("\tAn output file named without an extension, such as <jsonFile>,\n")
+	errorf("\tis given the extension of its format.\n")
+	errorf("\tSet %s=1 to refuse to run the subcommands that write to a radio.\n", readOnlyEnv)
 	os.Exit(1)
 }
 
@@ -95,24 +155,115 @@ func allTypesFrequencyRanges() (types []string, freqRanges map[string][]string)
 	return types, freqRanges
 }
 
+func printModelsUsage() {
+	errorf("\tmodelName must be chosen from the following list,\n")
+	errorf("\tand freqRange must be one of its associated values.\n")
+	types, freqs := allTypesFrequencyRanges()
+	for _, typ := range types {
+		errorf("\t\t%s\n", typ)
+		for _, freq := range freqs[typ] {
+			errorf("\t\t\t%s\n", "\""+freq+"\"")
+		}
+	}
+	printModelAliasesUsage()
+}
+
+func printModelAliasesUsage() {
+	errorf("\n\tmodelName and freqRange are matched ignoring case and spaces,\n")
+	errorf("\t-frequency may be used for -freq, and flags may begin with - or --.\n")
+}
+
+// addModelFlags adds the -model and -freq flags, and -frequency as an
+// alias of -freq.
+func addModelFlags(flags *flag.FlagSet, typ *string, freq *string) {
+	flags.StringVar(typ, "model", "", "<model name>")
+	flags.StringVar(freq, "freq", "", "<frequency range>")
+	flags.StringVar(freq, "frequency", "", "alias of -freq")
+}
+
+func modelKey(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), ""))
+}
+
+// canonicalModelName returns the model name matching typ, ignoring
+// case and spaces, or typ if there is none.
+func canonicalModelName(typ string) string {
+	for name := range codeplug.AllFrequencyRanges() {
+		if modelKey(name) == modelKey(typ) {
+			return name
+		}
+	}
+
+	return typ
+}
+
+// canonicalFrequencyRange returns the frequency range of model typ
+// matching freq, ignoring case and spaces, or freq if there is none.
+func canonicalFrequencyRange(typ string, freq string) string {
+	for _, name := range codeplug.AllFrequencyRanges()[typ] {
+		if modelKey(name) == modelKey(freq) {
+			return name
+		}
+	}
+
+	return freq
+}
+
+// checkModelFlags replaces *typ and *freq with the model and frequency
+// range they match, and exits with a usage message if they match none.
+func checkModelFlags(flags *flag.FlagSet, typ *string, freq *string) {
+	*typ = canonicalModelName(*typ)
+	*freq = canonicalFrequencyRange(*typ, *freq)
+
+	typeFreqs := codeplug.AllFrequencyRanges()
+	if typeFreqs[*typ] == nil {
+		errorf("bad modelName\n\n")
+		flags.Usage()
+	}
+	freqMap := make(map[string]bool)
+	for _, freq := range typeFreqs[*typ] {
+		freqMap[freq] = true
+	}
+	if !freqMap[*freq] {
+		errorf("bad freqRange\n\n")
+		flags.Usage()
+	}
+}
+
 func loadCodeplug(fType codeplug.FileType, filename string) (*codeplug.Codeplug, error) {
-	cp, err := codeplug.NewCodeplug(fType, filename)
+	if filename == stdinFilename {
+		return loadStdinCodeplug(fType)
+	}
+
+	name, cleanup, err := uncompressed(filename)
 	if err != nil {
 		return nil, err
 	}
+	defer cleanup()
 
-	types, freqs := cp.TypesFrequencyRanges()
-	if len(types) == 0 {
-		return nil, errors.New("unknown model in codeplug")
+	if fType == codeplug.FileTypeXLSX {
+		xlsxName, xlsxCleanup, err := normalizedXLSX(name, filename)
+		if err != nil {
+			return nil, err
+		}
+		defer xlsxCleanup()
+		name = xlsxName
 	}
 
-	typ := types[0]
-
-	if len(freqs[typ]) == 0 {
-		return nil, errors.New("unknown frequency range in codeplug")
+	cp, err := codeplug.NewCodeplug(fType, name)
+	if err != nil {
+		return nil, err
 	}
 
-	freqRange := freqs[typ][0]
+	var typ, freqRange string
+	if fType == codeplug.FileTypeJSON {
+		typ, freqRange, err = jsonCodeplugModel(cp, name, filename)
+	} else {
+		typ, freqRange, err = codeplugModel(cp)
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	err = cp.Load(typ, freqRange)
 	if err != nil {
@@ -122,6 +273,70 @@ func loadCodeplug(fType codeplug.FileType, filename string) (*codeplug.Codeplug,
 	return cp, nil
 }
 
+// progressIntervalEnv names the environment variable that overrides
+// defaultProgressInterval, e.g. DMRRADIO_PROGRESS_INTERVAL=250ms.
+const progressIntervalEnv = "DMRRADIO_PROGRESS_INTERVAL"
+
+const defaultProgressInterval = 100 * time.Millisecond
+
+// progressInterval returns the minimum time between progress updates.
+func progressInterval() time.Duration {
+	s := os.Getenv(progressIntervalEnv)
+	if s == "" {
+		return defaultProgressInterval
+	}
+
+	interval, err := time.ParseDuration(s)
+	if err != nil || interval < 0 {
+		errorf("ignoring bad %s: %s\n", progressIntervalEnv, s)
+		return defaultProgressInterval
+	}
+
+	return interval
+}
+
+// progressLogFile, if not nil, is the file named by -progress-log.
+var progressLogFile *os.File
+
+// progressLogOnly suppresses the progress shown on the terminal.
+var progressLogOnly bool
+
+// progressLogStep is the percentage between the progress lines logged
+// for each step.
+const progressLogStep = 10
+
+func addProgressFlags(flags *flag.FlagSet) {
+	flags.Var(progressLogValue{}, "progress-log", "append timestamped progress lines to this file")
+	flags.BoolVar(&progressLogOnly, "progress-log-only", false, "show progress only in the -progress-log file")
+}
+
+type progressLogValue struct{}
+
+func (progressLogValue) String() string {
+	return ""
+}
+
+func (progressLogValue) Set(filename string) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	progressLogFile = file
+
+	return nil
+}
+
+// logProgress appends a line for percent of step prefix, begun at
+// start, to the -progress-log file.
+func logProgress(prefix string, percent int, start time.Time) {
+	now := time.Now()
+	line := fmt.Sprintf("%s %s %3d%%", now.Format(time.RFC3339), prefix, percent)
+	if percent == 100 {
+		line += fmt.Sprintf(" in %v", now.Sub(start).Round(100*time.Millisecond))
+	}
+	fmt.Fprintln(progressLogFile, line)
+}
+
 func progressCallback(aPrefixes []string) func(cur int) error {
 	var prefixes []string
 	if aPrefixes != nil {
@@ -130,64 +345,116 @@ func progressCallback(aPrefixes []string) func(cur int) error {
 	prefixIndex := 0
 	prefix := prefixes[prefixIndex]
 	maxProgress := userdb.MaxProgress
+	interval := progressInterval()
+	var lastPrint time.Time
+	lastPercent := -1
+	var start time.Time
+	lastLogged := -1
 	return func(cur int) error {
 		if cur == 0 {
-			if prefixIndex != 0 {
+			if prefixIndex != 0 && !progressLogOnly {
 				fmt.Println()
 			}
 
-			prefix = prefixes[prefixIndex]
+			if prefixIndex < len(prefixes) {
+				prefix = prefixes[prefixIndex]
+			}
 			prefixIndex++
+			lastPrint = time.Time{}
+			lastPercent = -1
+			start = time.Now()
+			lastLogged = -1
 		}
 		percent := cur * 100 / maxProgress
+
+		if progressLogFile != nil && percent != lastLogged && (percent-lastLogged >= progressLogStep || percent == 100) {
+			logProgress(prefix, percent, start)
+			lastLogged = percent
+		}
+		if progressLogOnly {
+			return nil
+		}
+
+		// Coalesce updates that arrive faster than interval, but
+		// always show the start and end of each step.
+		now := time.Now()
+		if percent == lastPercent {
+			return nil
+		}
+		if cur != 0 && cur < maxProgress && now.Sub(lastPrint) < interval {
+			return nil
+		}
+		lastPrint = now
+		lastPercent = percent
+
 		fmt.Printf("%s... %3d%%\r", prefix, percent)
 		return nil
 	}
 }
 
+// runWithProgress calls fn, which does not report its own progress,
+// while displaying the elapsed time.
+func runWithProgress(prefix string, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			fmt.Printf("%s... done\n", prefix)
+			return err
+		case <-ticker.C:
+			fmt.Printf("%s... %ds\r", prefix, int(time.Since(start).Seconds()))
+		}
+	}
+}
+
+// interruptible returns a progress callback that calls progress and
+// returns an error once the user has interrupted the program, so that
+// the operation reporting progress stops at its next call.  The
+// returned function restores the default handling of interrupts.
+func interruptible(progress func(cur int) error) (func(cur int) error, func()) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	return func(cur int) error {
+		select {
+		case <-interrupt:
+			fmt.Println()
+			return errors.New("interrupted")
+		default:
+		}
+		return progress(cur)
+	}, func() { signal.Stop(interrupt) }
+}
+
 func newCodeplug() error {
 	var typ string
 	var freq string
 
 	flags := flag.NewFlagSet("newCodeplug", flag.ExitOnError)
-	flags.StringVar(&typ, "model", "", "<model name>")
-	flags.StringVar(&freq, "freq", "", "<frequency range>")
+	addModelFlags(flags, &typ, &freq)
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s -model <modelName> -freq <freqRange> codePlugFilename\n", os.Args[0], os.Args[1])
 		flags.PrintDefaults()
 		errorf("\nCreates a new default codeplug for the given radio model.\n\n")
-		errorf("\tmodelName must be chosen from the following list,\n")
-		errorf("\tand freqRange must be one of its associated values.\n")
-		types, freqs := allTypesFrequencyRanges()
-		for _, typ := range types {
-			errorf("\t\t%s\n", typ)
-			for _, freq := range freqs[typ] {
-				errorf("\t\t\t%s\n", "\""+freq+"\"")
-			}
-		}
+		printModelsUsage()
 		os.Exit(1)
 	}
 
-	typeFreqs := codeplug.AllFrequencyRanges()
-
 	flags.Parse(os.Args[2:])
 	args := flags.Args()
 	if len(args) != 1 {
 		flags.Usage()
 	}
-	if typeFreqs[typ] == nil {
-		errorf("bad modelName\n\n")
-		flags.Usage()
-	}
-	freqMap := make(map[string]bool)
-	for _, freq := range typeFreqs[typ] {
-		freqMap[freq] = true
-	}
-	if !freqMap[freq] {
-		errorf("bad freqRange\n\n")
-		flags.Usage()
-	}
+	checkModelFlags(flags, &typ, &freq)
 	filename := args[0]
 
 	cp, err := codeplug.NewCodeplug(codeplug.FileTypeNew, "")
@@ -204,49 +471,46 @@ func newCodeplug() error {
 }
 
 func readCodeplug() error {
+	return readCodeplugAs("readCodeplug", "codePlugFilename", formats["rdt"])
+}
+
+func readCodeplugToJSON() error {
+	return readCodeplugAs("readCodeplugToJSON", "jsonFilename", formats["json"])
+}
+
+func readCodeplugToText() error {
+	return readCodeplugAs("readCodeplugToText", "textFilename", formats["text"])
+}
+
+func readCodeplugToXLSX() error {
+	return readCodeplugAs("readCodeplugToXLSX", "xlsxFilename", formats["xlsx"])
+}
+
+// readCodeplugAs reads a codeplug from the radio and writes it in format
+// f, without an intermediate codeplug file.
+func readCodeplugAs(name string, fileArg string, f format) error {
 	var typ string
 	var freq string
 
-	flags := flag.NewFlagSet("readCodeplug", flag.ExitOnError)
-	flags.StringVar(&typ, "model", "", "<model name>")
-	flags.StringVar(&freq, "freq", "", "<frequency range>")
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	addModelFlags(flags, &typ, &freq)
+	addProgressFlags(flags)
 
 	flags.Usage = func() {
-		errorf("Usage: %s %s -model <modelName> -freq <freqRange> <codePlugFilename>\n", os.Args[0], os.Args[1])
+		errorf("Usage: %s %s -model <modelName> -freq <freqRange> <%s>\n", os.Args[0], os.Args[1], fileArg)
 		flags.PrintDefaults()
-		errorf("\nReads a codeplug from the radio into <codePlugFilename>.\n\n")
-		errorf("\tmodelName must be chosen from the following list,\n")
-		errorf("\tand freqRange must be one of its associated values.\n")
-		types, freqs := allTypesFrequencyRanges()
-		for _, typ := range types {
-			errorf("\t\t%s\n", typ)
-			for _, freq := range freqs[typ] {
-				errorf("\t\t\t%s\n", "\""+freq+"\"")
-			}
-		}
+		errorf("\nReads a codeplug from the radio into <%s>.\n\n", fileArg)
+		printModelsUsage()
 		os.Exit(1)
 	}
 
-	typeFreqs := codeplug.AllFrequencyRanges()
-
 	flags.Parse(os.Args[2:])
 	args := flags.Args()
 	if len(args) != 1 {
 		flags.Usage()
 	}
-	if typeFreqs[typ] == nil {
-		errorf("bad modelName\n\n")
-		flags.Usage()
-	}
-	freqMap := make(map[string]bool)
-	for _, freq := range typeFreqs[typ] {
-		freqMap[freq] = true
-	}
-	if !freqMap[freq] {
-		errorf("bad freqRange\n\n")
-		flags.Usage()
-	}
-	filename := args[0]
+	checkModelFlags(flags, &typ, &freq)
+	filename := withExtension(args[0], f.ext)
 
 	cp, err := codeplug.NewCodeplug(codeplug.FileTypeNew, "")
 	if err != nil {
@@ -268,16 +532,85 @@ func readCodeplug() error {
 		return err
 	}
 
-	return cp.SaveAs(filename)
+	return writeFormat(cp, f, filename)
+}
+
+const ftTalkaround = codeplug.FieldType("Talkaround")
+
+// verifyRadioCodeplug reads the codeplug back from the radio, once the
+// user has put it back in DFU mode after the write, and reports the
+// records that differ from those in cp.  BasicInformation, which holds
+// the time WriteRadio stamps on the radio's copy and is only partly
+// read back, and the Talkaround fields, which WriteRadio turns off,
+// are not compared.
+func verifyRadioCodeplug(cp *codeplug.Codeplug) error {
+	typ, freq := loadedModel(cp)
+	radioCp, err := defaultCodeplug(typ, freq)
+	if err != nil {
+		return err
+	}
+
+	err = awaitDFUMode()
+	if err != nil {
+		return err
+	}
+
+	prefixes := []string{
+		"Preparing to verify codeplug",
+		"Reading codeplug from radio",
+	}
+
+	err = radioCp.ReadRadio(progressCallback(prefixes))
+	if err != nil {
+		return err
+	}
+
+	var diffs []recordDiff
+	for _, d := range diffCodeplugRecords(cp, radioCp) {
+		if d.rType == rtBasicInfo {
+			continue
+		}
+
+		var fields []fieldDiff
+		for _, f := range d.fields {
+			if f.name != string(ftTalkaround) {
+				fields = append(fields, f)
+			}
+		}
+		if d.kind == diffChanged && len(fields) == 0 {
+			continue
+		}
+		d.fields = fields
+
+		diffs = append(diffs, d)
+	}
+
+	if len(diffs) != 0 {
+		printDiffs(diffs)
+		return fmt.Errorf("verify failed: %s", diffStats(diffs))
+	}
+
+	fmt.Println("Verified codeplug")
+	return nil
 }
 
 func writeCodeplug() error {
+	var c confirmation
+	var verify bool
+
 	flags := flag.NewFlagSet("writeCodeplug", flag.ExitOnError)
+	addProgressFlags(flags)
+	addStdinFlags(flags)
+	c.addFlags(flags)
+	flags.BoolVar(&verify, "verify", false, "read the codeplug back from the radio and compare it")
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <codeplugFilename>\n", os.Args[0], os.Args[1])
 		flags.PrintDefaults()
 		errorf("\nWrites the codeplug in <codeplugFilename> to the radio.\n")
+		errorf("With -verify, you are asked to put the radio back in DFU mode\n")
+		errorf("after the write; the records that differ from those written are\n")
+		errorf("then listed and the command fails.\n")
 		os.Exit(1)
 	}
 
@@ -293,17 +626,33 @@ func writeCodeplug() error {
 		return err
 	}
 
+	err = printCodeplugSummary(cp)
+	if err != nil {
+		return err
+	}
+
+	err = c.confirm("Erase the radio's codeplug and write " + filename)
+	if err != nil {
+		return err
+	}
+
 	prefixes := []string{
 		"Preparing to write codeplug to radio",
 		"Erasing the radio's codeplug",
 		"Writing codeplug to radio",
 	}
 
-	return cp.WriteRadio(progressCallback(prefixes))
+	err = cp.WriteRadio(progressCallback(prefixes))
+	if err == nil && verify {
+		err = verifyRadioCodeplug(cp)
+	}
+
+	return err
 }
 
-func readSPIFlash() (err error) {
+func readSPIFlash() error {
 	flags := flag.NewFlagSet("readSPIFlash", flag.ExitOnError)
+	addProgressFlags(flags)
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <filename>\n", os.Args[0], os.Args[1])
@@ -319,6 +668,11 @@ func readSPIFlash() (err error) {
 	}
 	filename := args[0]
 
+	err := checkDiskSpace(filename, spiFlashSize)
+	if err != nil {
+		return err
+	}
+
 	prefixes := []string{
 		"Preparing to read flash",
 		"Reading flash",
@@ -330,22 +684,15 @@ func readSPIFlash() (err error) {
 	}
 	defer dfu.Close()
 
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		cerr := file.Close()
-		if err == nil {
-			err = cerr
-		}
-	}()
-
-	return dfu.ReadSPIFlash(file)
+	return createFileAtomically(filename, dfu.ReadSPIFlash)
 }
 
-func readMD380Users() (err error) {
+func readMD380Users() error {
+	var gz bool
+
 	flags := flag.NewFlagSet("readMD380Users", flag.ExitOnError)
+	addProgressFlags(flags)
+	flags.BoolVar(&gz, "gzip", false, "gzip-compress the users file")
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <usersFilename>\n", os.Args[0], os.Args[1])
@@ -373,74 +720,271 @@ func readMD380Users() (err error) {
 	}
 	defer dfu.Close()
 
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("os.Create: %s", err.Error())
+	if !gz {
+		return createFileAtomically(filename, dfu.ReadMD380Users)
 	}
-	defer func() {
+
+	return writeFileAtomically(filename, func(tmpName string) error {
+		file, err := os.Create(tmpName)
+		if err != nil {
+			return err
+		}
+
+		err = dfu.ReadMD380Users(file)
 		cerr := file.Close()
 		if err == nil {
 			err = cerr
 		}
-	}()
+		if err != nil {
+			return err
+		}
 
-	return dfu.ReadMD380Users(file)
+		return gzipFile(tmpName)
+	})
+}
+
+// readRadioUsers reads the MD380 user database from the radio.
+func readRadioUsers(df *dfu.Dfu) (*userdb.UsersDB, error) {
+	tmp, err := ioutil.TempFile("", "users.*.csv")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = df.ReadMD380Users(tmp)
+	cerr := tmp.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return usersFromFile(tmp.Name(), userdb.Abbreviate(false))
+}
+
+// verifyRadioUsers reads the MD380 user database back from the radio,
+// once the user has put it back in DFU mode after the write, and
+// reports the users that differ from those in db.
+func verifyRadioUsers(db *userdb.UsersDB) error {
+	err := awaitDFUMode()
+	if err != nil {
+		return err
+	}
+
+	radioDB, err := readRadioUsersOnce([]string{
+		"Preparing to verify users",
+		"Reading users",
+	})
+	if err != nil {
+		return err
+	}
+
+	radioUsers := make(map[int]userdb.User)
+	for _, u := range radioDB.Users() {
+		radioUsers[u.ID] = *u
+	}
+
+	mismatches := 0
+	for _, u := range db.Users() {
+		radioU, ok := radioUsers[u.ID]
+		delete(radioUsers, u.ID)
+		if ok && radioU == *u {
+			continue
+		}
+
+		mismatches++
+		if ok {
+			errorf("user %d: wrote %s, read %s\n", u.ID, displayName(u), displayName(&radioU))
+		} else {
+			errorf("user %d: missing from the radio\n", u.ID)
+		}
+	}
+
+	for id := range radioUsers {
+		mismatches++
+		errorf("user %d: unexpected on the radio\n", id)
+	}
+
+	if mismatches != 0 {
+		return fmt.Errorf("verify failed: %d users differ", mismatches)
+	}
+
+	fmt.Println("Verified users")
+	return nil
+}
+
+// userChanges returns the number of users in db whose IDs are not in
+// radioDB, and the number whose IDs are in radioDB but whose other
+// fields differ there.
+func userChanges(radioDB, db *userdb.UsersDB) (added, changed int) {
+	radioUsers := make(map[int]userdb.User)
+	for _, u := range radioDB.Users() {
+		radioUsers[u.ID] = *u
+	}
+
+	for _, u := range db.Users() {
+		radioU, ok := radioUsers[u.ID]
+		switch {
+		case !ok:
+			added++
+		case radioU != *u:
+			changed++
+		}
+	}
+
+	return added, changed
 }
 
 func writeMD380Users() error {
+	var uw userWriteOptions
+	var c confirmation
+	var rollback bool
+	var verify bool
+	var appendOnly bool
+
 	flags := flag.NewFlagSet("writeMD380Users", flag.ExitOnError)
+	uw.addFlags(flags)
+	c.addFlags(flags)
+	flags.BoolVar(&rollback, "rollback", false, "read the radio's users first and restore them if the write fails")
+	flags.BoolVar(&verify, "verify", false, "read the users back from the radio and compare them")
+	flags.BoolVar(&appendOnly, "append-only", false, "read the radio's users first and skip the write if none are new or changed")
 
 	flags.Usage = func() {
-		errorf("Usage: %s %s <usersFilename>\n", os.Args[0], os.Args[1])
+		errorf("Usage: %s %s [-from-url <url>] <usersFilename>\n", os.Args[0], os.Args[1])
 		flags.PrintDefaults()
 		errorf("\nWrites the user database in <usersFilename> to the radio.\n")
+		errorf("\nThe radio leaves DFU mode after each read or write, so with\n")
+		errorf("-rollback or -append-only, which read the radio's users first,\n")
+		errorf("you are asked to put it back in DFU mode before the write.  You\n")
+		errorf("are asked again before the read of -verify and before a restore.\n")
+		errorf("\nWith -append-only, nothing is written when the radio already has\n")
+		errorf("every user in <usersFilename>, with the same callsign, name, and\n")
+		errorf("other fields.  The MD380 keeps its users sorted by ID behind a\n")
+		errorf("length header, so users cannot be appended or changed in place;\n")
+		errorf("when there are new or changed users, the whole database is written.\n")
 		os.Exit(1)
 	}
 
 	flags.Parse(os.Args[2:])
-	args := flags.Args()
-	if len(args) != 1 {
-		flags.Usage()
+	filename := uw.usersFilename(flags)
+
+	db, err := uw.loadUsers(filename)
+	if err != nil {
+		return err
 	}
 
-	filename := args[0]
+	err = c.confirm("Erase the radio's users and write " + uw.source(filename))
+	if err != nil {
+		return err
+	}
 
-	prefixes := []string{
+	var savedDB *userdb.UsersDB
+	if rollback || appendOnly {
+		savedDB, err = readRadioUsersOnce([]string{
+			"Preparing to read users",
+			"Saving the radio's users",
+		})
+		if err != nil {
+			return err
+		}
+
+		if appendOnly {
+			added, changed := userChanges(savedDB, db)
+			if added == 0 && changed == 0 {
+				fmt.Println("The radio already has every user, nothing written")
+				return nil
+			}
+			fmt.Printf("%d new and %d changed users, writing all %d users\n",
+				added, changed, len(db.Users()))
+		}
+
+		err = awaitDFUMode()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writeRadioUsersOnce(db, []string{
 		"Preparing to write users",
 		"Erasing flash memory",
 		"Writing users",
+	})
+	if err == nil && verify {
+		err = verifyRadioUsers(db)
+	}
+	if err == nil || !rollback {
+		return err
 	}
 
-	dfu, err := dfu.New(progressCallback(prefixes))
+	errorf("\nwriting users failed: %s\n", err.Error())
+
+	err = awaitDFUMode()
+	if err == nil {
+		err = writeRadioUsersOnce(savedDB, []string{
+			"Preparing to restore users",
+			"Erasing flash memory",
+			"Restoring the radio's users",
+		})
+	}
 	if err != nil {
-		return err
+		return fmt.Errorf("restoring the radio's users failed: %s", err.Error())
 	}
-	defer dfu.Close()
 
-	db, err := userdb.New(userdb.FromFile(filename), userdb.Abbreviate(false))
+	return errors.New("the radio's previous users were restored")
+}
+
+// readRadioUsersOnce opens the radio, reads its MD380 user database,
+// and closes it.  The radio leaves DFU mode afterward.
+func readRadioUsersOnce(prefixes []string) (*userdb.UsersDB, error) {
+	df, err := dfu.New(progressCallback(prefixes))
+	if err != nil {
+		return nil, err
+	}
+	defer df.Close()
+
+	return readRadioUsers(df)
+}
+
+// writeRadioUsersOnce opens the radio, writes db as its MD380 user
+// database, and closes it.  The radio leaves DFU mode afterward.
+func writeRadioUsersOnce(db *userdb.UsersDB, prefixes []string) error {
+	df, err := dfu.New(progressCallback(prefixes))
 	if err != nil {
 		return err
 	}
-	return dfu.WriteMD380Users(db)
+	defer df.Close()
+
+	return df.WriteMD380Users(db)
 }
 
 func writeMD2017Users() error {
+	var uw userWriteOptions
+	var c confirmation
+
 	flags := flag.NewFlagSet("writeMD2017Users", flag.ExitOnError)
+	uw.addFlags(flags)
+	c.addFlags(flags)
 
 	flags.Usage = func() {
-		errorf("Usage: %s %s <usersFilename>\n", os.Args[0], os.Args[1])
+		errorf("Usage: %s %s [-from-url <url>] <usersFilename>\n", os.Args[0], os.Args[1])
 		flags.PrintDefaults()
 		errorf("\nWrites the user database in <usersFilename> to the radio.\n")
 		os.Exit(1)
 	}
 
 	flags.Parse(os.Args[2:])
-	args := flags.Args()
-	if len(args) != 1 {
-		flags.Usage()
+	filename := uw.usersFilename(flags)
+
+	db, err := uw.loadUsers(filename)
+	if err != nil {
+		return err
 	}
 
-	filename := args[0]
+	err = c.confirm("Erase the radio's users and write " + uw.source(filename))
+	if err != nil {
+		return err
+	}
 
 	prefixes := []string{
 		"Preparing to write users",
@@ -454,30 +998,36 @@ func writeMD2017Users() error {
 	}
 	defer df.Close()
 
-	db, err := userdb.New(userdb.FromFile(filename), userdb.Abbreviate(false))
-	if err != nil {
-		return err
-	}
 	return df.WriteUV380Users(db)
 }
 
 func writeUV380Users() error {
+	var uw userWriteOptions
+	var c confirmation
+
 	flags := flag.NewFlagSet("writeUV380Users", flag.ExitOnError)
+	uw.addFlags(flags)
+	c.addFlags(flags)
 
 	flags.Usage = func() {
-		errorf("Usage: %s %s <usersFilename>\n", os.Args[0], os.Args[1])
+		errorf("Usage: %s %s [-from-url <url>] <usersFilename>\n", os.Args[0], os.Args[1])
 		flags.PrintDefaults()
 		errorf("\nWrites the user database in <usersFilename> to the radio.\n")
 		os.Exit(1)
 	}
 
 	flags.Parse(os.Args[2:])
-	args := flags.Args()
-	if len(args) != 1 {
-		flags.Usage()
+	filename := uw.usersFilename(flags)
+
+	db, err := uw.loadUsers(filename)
+	if err != nil {
+		return err
 	}
 
-	filename := args[0]
+	err = c.confirm("Erase the radio's users and write " + uw.source(filename))
+	if err != nil {
+		return err
+	}
 
 	prefixes := []string{
 		"Preparing to write users",
@@ -491,21 +1041,284 @@ func writeUV380Users() error {
 	}
 	defer df.Close()
 
-	db, err := userdb.New(userdb.FromFile(filename), userdb.Abbreviate(false))
+	return df.WriteUV380Users(db)
+}
+
+// retrievalProgress returns a userdb option that shows the progress of
+// a download as each of its sources is parsed.  userdb downloads in
+// New, so the callback must be set by an option passed to New.
+func retrievalProgress() userdb.DBOption {
+	return func(db *userdb.UsersDB) {
+		db.SetProgressCallback(progressCallback([]string{"Retrieving Users file"}))
+	}
+}
+
+func retrieveUsers(db *userdb.UsersDB, filename string, uo *userOutputOptions, ur *userReadOptions, edits ...usersEdit) error {
+	if len(db.Users()) == 0 {
+		return errors.New("no users were retrieved")
+	}
+
+	err := ur.checkParse(db, "")
+	if err != nil {
+		return err
+	}
+
+	for _, edit := range edits {
+		err := edit(db.Users())
+		if err != nil {
+			return err
+		}
+	}
+
+	count, err := uo.writeUsersFile(db, filename)
 	if err != nil {
 		return err
 	}
 
+	if uo.count {
+		fmt.Printf("\nRetrieved %d users\n", count)
+	}
+
+	return nil
+}
+
+// userLayouts maps radio models, by their canonical names, to the
+// subcommand that writes the user database in the layout used by that
+// model.
+var userLayouts = map[string]string{
+	"MD-380":   "writeMD380Users",
+	"RT3":      "writeMD380Users",
+	"MD-390":   "writeMD380Users",
+	"RT3-G":    "writeMD380Users",
+	"MD-2017":  "writeMD2017Users",
+	"RT82":     "writeMD2017Users",
+	"MD-9600":  "writeMD2017Users",
+	"RT90":     "writeMD2017Users",
+	"MD-UV380": "writeUV380Users",
+	"MD-UV390": "writeUV380Users",
+	"RT3S":     "writeUV380Users",
+	"RT84":     "writeUV380Users",
+}
+
+func userLayoutModels() []string {
+	models := make([]string, 0, len(userLayouts))
+	for model := range userLayouts {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	return models
+}
+
+// radioModelName asks the radio, which must be in DFU mode, for the
+// model name it reports in programming mode, such as "DR780" or
+// "MD-UV380".  The radio is left in DFU mode.
+func radioModelName() (string, error) {
+	s, err := stdfu.New()
+	if err != nil {
+		return "", err
+	}
+	defer s.Close()
+
+	err = s.SelectCurrentConfiguration(0, 0, 0)
+	if err != nil {
+		return "", err
+	}
+
+	// The two bytes of each command are sent to the control block,
+	// as the dfu package's commands are.
+	for _, cmd := range [][]byte{
+		{0x91, 0x01}, // programming mode
+		{0xa2, 0x01}, // model name
+	} {
+		err = awaitDFUState(s, stdfu.DfuIdle)
+		if err != nil {
+			return "", err
+		}
+
+		err = s.Dnload(0, cmd)
+		if err != nil {
+			return "", err
+		}
+
+		err = awaitDFUState(s, stdfu.DfuWriteIdle)
+		if err != nil {
+			return "", fmt.Errorf("command %02x%02x: %s", cmd[0], cmd[1], err.Error())
+		}
+
+		err = s.Abort()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	name := make([]byte, 32)
+	err = s.Upload(0, name)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.Abort()
+	if err != nil {
+		return "", err
+	}
+
+	for i, b := range name {
+		if b == 0x00 || b == 0xff {
+			name = name[:i]
+			break
+		}
+	}
+
+	return strings.TrimSpace(string(name)), nil
+}
+
+// awaitDFUState polls the radio's DFU status until it reaches state,
+// clearing an error status on the way, for up to a second.
+func awaitDFUState(s *stdfu.StDfu, state stdfu.State) error {
+	for i := 0; i < 10; i++ {
+		status, err := s.GetStatus()
+		if err != nil {
+			return err
+		}
+
+		switch status.State {
+		case state:
+			return nil
+		case stdfu.DfuError:
+			err = s.ClrStatus()
+			if err != nil {
+				return err
+			}
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return fmt.Errorf("radio did not reach the %s state", state)
+}
+
+// detectUserLayout returns the userLayouts subcommand for the radio,
+// which must be in DFU mode, by the model name it reports.  Several
+// models may report the same name; it is an error if they use
+// different layouts.
+func detectUserLayout() (string, error) {
+	name, err := radioModelName()
+	if err != nil {
+		return "", fmt.Errorf("detecting the radio model: %s", err.Error())
+	}
+
+	layout := ""
+	for _, model := range userLayoutModels() {
+		freqRanges := codeplug.AllFrequencyRanges()[model]
+		if len(freqRanges) == 0 {
+			continue
+		}
+
+		cp, err := defaultCodeplug(model, freqRanges[0])
+		if err != nil {
+			return "", err
+		}
+		if !containsString(cp.CodeplugInfo().Models, name) {
+			continue
+		}
+
+		if layout != "" && layout != userLayouts[model] {
+			return "", fmt.Errorf("radio model %q is used by models with different user layouts, use -model", name)
+		}
+		layout = userLayouts[model]
+	}
+
+	if layout == "" {
+		return "", fmt.Errorf("unsupported radio model %q, use -model", name)
+	}
+
+	fmt.Printf("Detected a %s radio\n", name)
+	return layout, nil
+}
+
+func writeUsers() error {
+	var uw userWriteOptions
+	var c confirmation
+	var model string
+
+	flags := flag.NewFlagSet("writeUsers", flag.ExitOnError)
+	flags.StringVar(&model, "model", "", "<model name>, instead of detecting the radio's model")
+	uw.addFlags(flags)
+	c.addFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s [-model <modelName>] <usersFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nWrites the user database in <usersFilename> to the radio,\n")
+		errorf("in the layout used by its model.  The model is detected by\n")
+		errorf("asking the radio for its model name, unless -model is given.\n")
+		errorf("\tmodelName must be one of: %s\n", strings.Join(userLayoutModels(), ", "))
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	filename := uw.usersFilename(flags)
+
+	layout := ""
+	if model != "" {
+		layout = userLayouts[canonicalModelName(model)]
+		if layout == "" {
+			errorf("bad modelName\n\n")
+			flags.Usage()
+		}
+	}
+
+	db, err := uw.loadUsers(filename)
+	if err != nil {
+		return err
+	}
+
+	err = c.confirm("Erase the radio's users and write " + uw.source(filename))
+	if err != nil {
+		return err
+	}
+
+	if layout == "" {
+		layout, err = detectUserLayout()
+		if err != nil {
+			return err
+		}
+	}
+
+	prefixes := []string{
+		"Preparing to write users",
+		"Erasing flash memory",
+		"Writing users",
+	}
+
+	df, err := dfu.New(progressCallback(prefixes))
+	if err != nil {
+		return err
+	}
+	defer df.Close()
+
+	if layout == "writeMD380Users" {
+		return df.WriteMD380Users(db)
+	}
+
 	return df.WriteUV380Users(db)
 }
 
 func getUsers() error {
+	var uo userOutputOptions
+	var ur userReadOptions
+
 	flags := flag.NewFlagSet("getUsers", flag.ExitOnError)
+	uo.addFlags(flags)
+	ur.addFlags(flags)
+	addTimeoutFlag(flags)
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <usersFilename>\n", os.Args[0], os.Args[1])
 		flags.PrintDefaults()
 		errorf("\nDownloads a curated user database into <usersFilename>.\n")
+		printFilterUsage(userFilterFields)
 		os.Exit(1)
 	}
 
@@ -516,27 +1329,31 @@ func getUsers() error {
 	}
 	filename := args[0]
 
-	prefixes := []string{
-		"Retrieving Users file",
-	}
-
-	db, err := userdb.New(userdb.CuratedUsers(), userdb.Abbreviate(false))
+	db, err := downloadUsers(userdb.CuratedUsers(), userdb.Abbreviate(false), retrievalProgress())
 	if err != nil {
 		return err
 	}
 
-	db.SetProgressCallback(progressCallback(prefixes))
-	return db.WriteMD380ToolsFile(filename)
+	return retrieveUsers(db, filename, &uo, &ur, ur.edits()...)
 }
 
 func getAbbreviatedUsers() error {
+	var uo userOutputOptions
+	var localeCode string
+	var ur userReadOptions
+
 	flags := flag.NewFlagSet("getAbbreviatedUsers", flag.ExitOnError)
+	uo.addFlags(flags)
+	ur.addFlags(flags)
+	addTimeoutFlag(flags)
+	flags.StringVar(&localeCode, "locale", "", "also abbreviate the states of this country: "+strings.Join(localeCodes(), ", "))
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <usersFilename>\n", os.Args[0], os.Args[1])
 		flags.PrintDefaults()
 		errorf("\nDownloads a curated user database into <usersFilename>.\n")
 		errorf("The names of many states and countries are abbreviated.\n")
+		printFilterUsage(userFilterFields)
 		os.Exit(1)
 	}
 
@@ -547,27 +1364,38 @@ func getAbbreviatedUsers() error {
 	}
 	filename := args[0]
 
-	prefixes := []string{
-		"Retrieving Users file",
+	edits := ur.edits()
+	if localeCode != "" {
+		edit, err := abbreviateLocale(localeCode)
+		if err != nil {
+			return err
+		}
+		edits = append(edits, edit)
 	}
 
-	db, err := userdb.New(userdb.CuratedUsers(), userdb.Abbreviate(true))
+	db, err := downloadUsers(userdb.CuratedUsers(), userdb.Abbreviate(true), retrievalProgress())
 	if err != nil {
 		return err
 	}
 
-	db.SetProgressCallback(progressCallback(prefixes))
-	return db.WriteMD380ToolsFile(filename)
+	return retrieveUsers(db, filename, &uo, &ur, edits...)
 }
 
 func getMergedUsers() error {
+	var uo userOutputOptions
+	var ur userReadOptions
+
 	flags := flag.NewFlagSet("getMergedUsers", flag.ExitOnError)
+	uo.addFlags(flags)
+	ur.addFlags(flags)
+	addTimeoutFlag(flags)
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <usersFilename>\n", os.Args[0], os.Args[1])
 		flags.PrintDefaults()
 		errorf("\nDownloads the user database from multiple websites and merges them\n")
 		errorf("into <usersFilename>.\n")
+		printFilterUsage(userFilterFields)
 		os.Exit(1)
 	}
 
@@ -578,21 +1406,20 @@ func getMergedUsers() error {
 	}
 	filename := args[0]
 
-	prefixes := []string{
-		"Retrieving Users file",
-	}
-
-	db, err := userdb.New(userdb.MergeNewUsers(), userdb.Abbreviate(false))
+	db, err := downloadUsers(userdb.MergeNewUsers(), userdb.Abbreviate(false), retrievalProgress())
 	if err != nil {
 		return err
 	}
 
-	db.SetProgressCallback(progressCallback(prefixes))
-	return db.WriteMD380ToolsFile(filename)
+	return retrieveUsers(db, filename, &uo, &ur, ur.edits()...)
 }
 
 func writeMD380Firmware() error {
+	var c confirmation
+
 	flags := flag.NewFlagSet("writeMD380Firmware", flag.ExitOnError)
+	addProgressFlags(flags)
+	c.addFlags(flags)
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <firmwareFilename>\n", os.Args[0], os.Args[1])
@@ -608,6 +1435,17 @@ func writeMD380Firmware() error {
 	}
 	filename := args[0]
 
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = c.confirm("Erase the radio's firmware and write " + filename)
+	if err != nil {
+		return err
+	}
+
 	prefixes := []string{
 		"Preparing to firmware",
 		"Erasing flash memory",
@@ -620,18 +1458,14 @@ func writeMD380Firmware() error {
 	}
 	defer dfu.Close()
 
-	file, err := os.Open(filename)
-	if err != nil {
-		l.Fatalf("writeMD380Firmware: %s", err.Error())
-	}
-
-	defer file.Close()
-
 	return dfu.WriteFirmware(file)
 }
 
 func textToCodeplug() error {
+	var doValidate bool
+
 	flags := flag.NewFlagSet("textToCodeplug", flag.ExitOnError)
+	flags.BoolVar(&doValidate, "validate", false, "check all fields and references before saving")
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <textFilename> <codeplugFilename>\n", os.Args[0], os.Args[1])
@@ -647,51 +1481,150 @@ func textToCodeplug() error {
 		flags.Usage()
 	}
 	textFilename := args[0]
-	codeplugFilename := args[1]
+	codeplugFilename := withExtension(args[1], formats["rdt"].ext)
 
-	cp, err := loadCodeplug(codeplug.FileTypeText, textFilename)
+	var cp *codeplug.Codeplug
+	err := runWithProgress("Reading "+textFilename, func() error {
+		var err error
+		cp, err = loadCodeplug(codeplug.FileTypeText, textFilename)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = checkFrequencies(cp, textFilename)
 	if err != nil {
 		return err
 	}
 
+	if doValidate {
+		err = validate(cp, textFilename)
+		if err != nil {
+			return err
+		}
+	}
+
 	return cp.SaveAs(codeplugFilename)
 }
 
 func codeplugToText() error {
+	var gz bool
+	var groupBy string
+	var callType string
+
 	flags := flag.NewFlagSet("codeplugToText", flag.ExitOnError)
+	addStdinFlags(flags)
+	addCallTypeFlag(flags, &callType)
+	flags.BoolVar(&gz, "gzip", false, "gzip-compress <textFilename>")
+	flags.StringVar(&groupBy, "group-by", "", "\"zone\" to list the channels under each zone")
+	addIndexBaseFlag(flags)
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <codeplugFilename> <textFilename>\n", os.Args[0], os.Args[1])
 		flags.PrintDefaults()
 		errorf("\nCreates a <textfilename> containing a textual representation of\n")
-		errorf("of the codeplug in <codeplugFilename>.\n")
+		errorf("of the codeplug in <codeplugFilename>.  Records are numbered\n")
+		errorf("from -base.\n")
+		errorf("With -group-by zone, the file lists the channels under each zone\n")
+		errorf("that contains them, then the channels in no zone under \"Unzoned\".\n")
+		errorf("It is meant for reading and cannot be read by textToCodeplug.\n")
+		printCallTypeUsage()
 		os.Exit(1)
 	}
 
 	flags.Parse(os.Args[2:])
 	args := flags.Args()
-	if len(args) != 2 {
+	if len(args) != 2 || (groupBy != "" && groupBy != "zone") {
 		flags.Usage()
 	}
 	codeplugFilename := args[0]
-	textFilename := args[1]
+	textFilename := withExtension(args[1], gzExtension(formats["text"].ext, gz))
 
 	cp, err := loadCodeplug(codeplug.FileTypeNone, codeplugFilename)
 	if err != nil {
 		return err
 	}
 
-	return cp.ExportText(textFilename)
+	if callType != "" {
+		err = keepCallType(cp, callType)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = checkDiskSpace(textFilename, estimateExportSize(cp))
+	if err != nil {
+		return err
+	}
+
+	export := func(filename string) error {
+		return exportText(cp, filename)
+	}
+	if groupBy == "zone" {
+		export = func(filename string) error {
+			return exportTextByZone(cp, filename)
+		}
+	}
+
+	return writeFileAtomically(textFilename, func(tmpName string) error {
+		err := export(tmpName)
+		if err != nil || !gz {
+			return err
+		}
+
+		return gzipFile(tmpName)
+	})
+}
+
+// exportText writes cp to filename as codeplug.ExportText does, but
+// with each record's number, counted from indexBase, after its type.
+// textToCodeplug ignores the numbers.
+func exportText(cp *codeplug.Codeplug, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	for i, rType := range cp.RecordTypes() {
+		for j, r := range cp.Records(rType) {
+			if i != 0 || j != 0 {
+				fmt.Fprintln(w)
+			}
+
+			var b strings.Builder
+			codeplug.PrintRecord(&b, r)
+			text := b.String()
+			if r.MaxRecords() > 1 {
+				text = fmt.Sprintf("%s[%d]", rType, recordNumber(r)) + strings.TrimPrefix(text, string(rType))
+			}
+			w.WriteString(text)
+		}
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
 }
 
 func jsonToCodeplug() error {
+	var doValidate bool
+
 	flags := flag.NewFlagSet("jsonToCodeplug", flag.ExitOnError)
+	flags.BoolVar(&doValidate, "validate", false, "check all fields and references before saving")
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <jsonFilename> <codeplugFilename>\n", os.Args[0], os.Args[1])
 		flags.PrintDefaults()
 		errorf("\nCreates a codeplug file, <codeplugFilename>, from the JSON\n")
 		errorf("representation in <jsonFilename>\n")
+		errorf("The model and frequency range are those recorded in its\n")
+		errorf("BasicInformation, as written by codeplugToJSON.\n")
 		os.Exit(1)
 	}
 
@@ -701,24 +1634,54 @@ func jsonToCodeplug() error {
 		flags.Usage()
 	}
 	jsonFilename := args[0]
-	codeplugFilename := args[1]
+	codeplugFilename := withExtension(args[1], formats["rdt"].ext)
 
 	cp, err := loadCodeplug(codeplug.FileTypeJSON, jsonFilename)
 	if err != nil {
 		return err
 	}
 
+	err = checkFrequencies(cp, jsonFilename)
+	if err != nil {
+		return err
+	}
+
+	if doValidate {
+		err = validate(cp, jsonFilename)
+		if err != nil {
+			return err
+		}
+	}
+
 	return cp.SaveAs(codeplugFilename)
 }
 
 func codeplugToJSON() error {
+	var types string
+	var gz bool
+	var filterExpr string
+	filterType := string(rtChannels)
+	var callType string
+
 	flags := flag.NewFlagSet("codeplugToJSON", flag.ExitOnError)
+	addStdinFlags(flags)
+	addCallTypeFlag(flags, &callType)
+	flags.StringVar(&types, "types", "", "comma-separated record types to include (default: all)")
+	flags.BoolVar(&gz, "gzip", false, "gzip-compress <jsonFilename>")
+	flags.StringVar(&filterExpr, "filter", "", "include only the records matching this expression, e.g. 'RxFrequency > 440 && Power == High'")
+	flags.StringVar(&filterType, "filter-type", filterType, "record type that -filter selects")
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <codeplugFilename> <jsonFilename>\n", os.Args[0], os.Args[1])
 		flags.PrintDefaults()
 		errorf("\nCreates <jsonfilename> containing a JSON representation of\n")
 		errorf("of the codeplug in <codeplugFilename>.\n")
+		errorf("With -types, only the listed record types are included.  When such\n")
+		errorf("a file is imported, the other record types keep their default values.\n")
+		errorf("With -filter, only the records of the -filter-type matching the\n")
+		errorf("expression are included; its fields are the fields of that type.\n")
+		printCallTypeUsage()
+		printFilterUsage(nil)
 		os.Exit(1)
 	}
 
@@ -728,24 +1691,79 @@ func codeplugToJSON() error {
 		flags.Usage()
 	}
 	codeplugFilename := args[0]
-	jsonFilename := args[1]
+	jsonFilename := withExtension(args[1], gzExtension(formats["json"].ext, gz))
 
 	cp, err := loadCodeplug(codeplug.FileTypeNone, codeplugFilename)
 	if err != nil {
 		return err
 	}
 
-	return cp.ExportJSON(jsonFilename)
+	recordTypes := splitList(types)
+	err = checkRecordTypes(cp, recordTypes)
+	if err != nil {
+		return err
+	}
+
+	if filterExpr != "" {
+		err = checkRecordTypes(cp, []string{filterType})
+		if err != nil {
+			return err
+		}
+
+		removed, err := filterRecords(cp, codeplug.RecordType(filterType), filterExpr)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d %s records did not match -filter\n", removed, filterType)
+	}
+
+	if callType != "" {
+		err = keepCallType(cp, callType)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = checkDiskSpace(jsonFilename, estimateExportSize(cp))
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(jsonFilename, func(tmpName string) error {
+		err := cp.ExportJSON(tmpName)
+		if err != nil {
+			return err
+		}
+
+		if len(recordTypes) != 0 {
+			err = filterJSONRecordTypes(tmpName, cp, recordTypes)
+			if err != nil {
+				return err
+			}
+		}
+
+		if gz {
+			return gzipFile(tmpName)
+		}
+
+		return nil
+	})
 }
 
 func xlsxToCodeplug() error {
+	var doValidate bool
+
 	flags := flag.NewFlagSet("xlsxToCodeplug", flag.ExitOnError)
+	flags.BoolVar(&doValidate, "validate", false, "check all fields and references before saving")
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <xlsxFilename> <codeplugFilename>\n", os.Args[0], os.Args[1])
 		flags.PrintDefaults()
 		errorf("\nCreates a codeplug file, <codeplugFilename>, from the spreadsheet\n")
 		errorf("in <xlsxFilename>\n")
+		errorf("Cells are read by their stored values, ignoring number formats and\n")
+		errorf("surrounding white space.  Cells that cannot be interpreted, such as\n")
+		errorf("error values, are reported and no codeplug is written.\n")
 		os.Exit(1)
 	}
 
@@ -755,24 +1773,43 @@ func xlsxToCodeplug() error {
 		flags.Usage()
 	}
 	xlsxFilename := args[0]
-	codeplugFilename := args[1]
+	codeplugFilename := withExtension(args[1], formats["rdt"].ext)
 
 	cp, err := loadCodeplug(codeplug.FileTypeXLSX, xlsxFilename)
 	if err != nil {
 		return err
 	}
 
+	err = checkFrequencies(cp, xlsxFilename)
+	if err != nil {
+		return err
+	}
+
+	if doValidate {
+		err = validate(cp, xlsxFilename)
+		if err != nil {
+			return err
+		}
+	}
+
 	return cp.SaveAs(codeplugFilename)
 }
 
 func codeplugToXLSX() error {
+	var callType string
+
 	flags := flag.NewFlagSet("codeplugToXLSX", flag.ExitOnError)
+	addStdinFlags(flags)
+	addCallTypeFlag(flags, &callType)
+	addIndexBaseFlag(flags)
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <codeplugFilename> <xlsxFilename>\n", os.Args[0], os.Args[1])
 		flags.PrintDefaults()
 		errorf("\nCreates <xlsxfilename> containing a spreadsheet representation of\n")
-		errorf("of the codeplug in <codeplugFilename>.\n")
+		errorf("of the codeplug in <codeplugFilename>.  The first column holds\n")
+		errorf("the record numbers, counted from -base.\n")
+		printCallTypeUsage()
 		os.Exit(1)
 	}
 
@@ -782,18 +1819,40 @@ func codeplugToXLSX() error {
 		flags.Usage()
 	}
 	codeplugFilename := args[0]
-	xlsxFilename := args[1]
+	xlsxFilename := withExtension(args[1], formats["xlsx"].ext)
 
 	cp, err := loadCodeplug(codeplug.FileTypeNone, codeplugFilename)
 	if err != nil {
 		return err
 	}
 
-	return cp.ExportXLSX(xlsxFilename)
+	if callType != "" {
+		err = keepCallType(cp, callType)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = checkDiskSpace(xlsxFilename, estimateExportSize(cp))
+	if err != nil {
+		return err
+	}
+
+	progress, stop := interruptible(progressCallback([]string{"Writing XLSX"}))
+	defer stop()
+
+	return writeFileAtomically(xlsxFilename, func(tmpName string) error {
+		return exportXLSX(cp, tmpName, progress)
+	})
 }
 
 func userCountries() error {
+	var ur userReadOptions
+	var uf userFileOptions
+
 	flags := flag.NewFlagSet("userCountries", flag.ExitOnError)
+	ur.addFlags(flags)
+	uf.addFlags(flags)
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <usersFilename> <countriesFilename>\n", os.Args[0], os.Args[1])
@@ -812,36 +1871,49 @@ func userCountries() error {
 	usersFilename := args[0]
 	countriesFilename := args[1]
 
-	db, err := userdb.New(userdb.FromFile(usersFilename), userdb.Abbreviate(false))
+	db, err := uf.usersFromFile(usersFilename, userdb.Abbreviate(false))
 	if err != nil {
 		return err
 	}
 
-	countries, err := db.AllCountries()
+	err = ur.checkParse(db, usersFilename)
 	if err != nil {
 		return err
 	}
 
-	countriesFile, err := os.Create(countriesFilename)
+	err = ur.editUsers(db)
 	if err != nil {
 		return err
 	}
 
-	for _, country := range countries {
-		if country == "" {
-			country = "<none>"
-		}
-
-		fmt.Fprintln(countriesFile, country)
+	countries, err := ur.countries(db)
+	if err != nil {
+		return err
 	}
 
-	countriesFile.Close()
+	return createFileAtomically(countriesFilename, func(countriesFile io.Writer) error {
+		for _, country := range countries {
+			if country == "" {
+				country = "<none>"
+			}
 
-	return nil
+			_, err := fmt.Fprintln(countriesFile, country)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
 func countryCounts() error {
+	var ur userReadOptions
+	var uf userFileOptions
+
 	flags := flag.NewFlagSet("countryCounts", flag.ExitOnError)
+	ur.addFlags(flags)
+	uf.addFlags(flags)
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <usersFilename>\n", os.Args[0], os.Args[1])
@@ -853,28 +1925,37 @@ func countryCounts() error {
 
 	flags.Parse(os.Args[2:])
 	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
 
 	usersFilename := args[0]
 
-	db, err := userdb.New(userdb.FromFile(usersFilename), userdb.Abbreviate(false))
+	db, err := uf.usersFromFile(usersFilename, userdb.Abbreviate(false))
+	if err != nil {
+		return err
+	}
+
+	err = ur.checkParse(db, usersFilename)
+	if err != nil {
+		return err
+	}
+
+	err = ur.editUsers(db)
 	if err != nil {
 		return err
 	}
 
-	countries, err := db.AllCountries()
+	countries, err := ur.countries(db)
 	if err != nil {
 		return err
 	}
 
 	users := db.Users()
+	counts := countryUserCounts(users)
 
 	for _, country := range countries {
-		count := 0
-		for _, user := range users {
-			if user.Country == country {
-				count++
-			}
-		}
+		count := counts[country]
 
 		if country == "" {
 			country = "<none>"
@@ -888,19 +1969,114 @@ func countryCounts() error {
 	return nil
 }
 
+func countryUserCounts(users []*userdb.User) map[string]int {
+	counts := make(map[string]int)
+	for _, user := range users {
+		counts[user.Country]++
+	}
+
+	return counts
+}
+
+func exportCountriesTemplate() error {
+	var ur userReadOptions
+	var uf userFileOptions
+
+	flags := flag.NewFlagSet("exportCountriesTemplate", flag.ExitOnError)
+	ur.addFlags(flags)
+	uf.addFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <usersFilename> <countriesFilename>\n", os.Args[0], os.Args[1])
+		errorf("  where <usersFilename> is the name of a user file.\n\n")
+		flags.PrintDefaults()
+		errorf("\nWrites <countriesFilename>, a countries file for filterUsers that\n")
+		errorf("lists every country in <usersFilename> with its number of users.\n")
+		errorf("Each country is commented out; uncomment the ones to keep.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 2 {
+		flags.Usage()
+	}
+
+	usersFilename := args[0]
+	countriesFilename := args[1]
+
+	db, err := uf.usersFromFile(usersFilename, userdb.Abbreviate(false))
+	if err != nil {
+		return err
+	}
+
+	err = ur.checkParse(db, usersFilename)
+	if err != nil {
+		return err
+	}
+
+	err = ur.editUsers(db)
+	if err != nil {
+		return err
+	}
+
+	countries, err := ur.countries(db)
+	if err != nil {
+		return err
+	}
+
+	counts := countryUserCounts(db.Users())
+
+	return createFileAtomically(countriesFilename, func(countriesFile io.Writer) error {
+		_, err := fmt.Fprintf(countriesFile, "# Countries in %s.\n", filepath.Base(usersFilename))
+		if err == nil {
+			_, err = fmt.Fprintf(countriesFile, "# Uncomment the countries to include with filterUsers.\n\n")
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, country := range countries {
+			count := counts[country]
+			if country == "" {
+				country = "<none>"
+			}
+
+			_, err := fmt.Fprintf(countriesFile, "# %-40s # %d users\n", country, count)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
 func filterUsers() error {
+	var aliasFilename string
+	var fromURL string
+	var uo userOutputOptions
+	var uf userFileOptions
+
 	flags := flag.NewFlagSet("filterUsers", flag.ExitOnError)
+	uo.addFlags(flags)
+	uf.addFlags(flags)
+	flags.StringVar(&aliasFilename, "alias-file", "", "file of additional country aliases, see listCountryAliases")
+	flags.StringVar(&fromURL, "from-url", "", "download <inUsersFile> from this URL, <inUsersFile> must be \"\"")
+	addDownloadFlags(flags)
 
 	flags.Usage = func() {
 		errorf("Usage: %s %s <countriesFile> <inUsersFile> <outUsersFile>\n", os.Args[0], os.Args[1])
 		errorf("  where <countriesFile> contains a list of countries, one per line.\n\n")
 		errorf("    Blank lines and lines beginning with '#' are ignored.\n")
 		errorf("    Only users in the listed countries will be included in the output.\n")
+		errorf("    Alternate names of a country, such as USA and United States, match.\n")
 		errorf("  <inUsersFile> is an existing userdb file\n")
 		errorf("    If <inUsersFile> is \"\", a curated users file will be downloaded.\n")
 		errorf("  <outUsersFile> will be created with users filtered by countries.\n")
 
 		flags.PrintDefaults()
+		printFilterUsage(userFilterFields)
 		os.Exit(1)
 	}
 
@@ -912,11 +2088,22 @@ func filterUsers() error {
 	countriesFilename := args[0]
 	inUsersFilename := args[1]
 	outUsersFilename := args[2]
+	if fromURL != "" && inUsersFilename != "" {
+		flags.Usage()
+	}
+
+	if aliasFilename != "" {
+		err := readCountryAliases(aliasFilename)
+		if err != nil {
+			return err
+		}
+	}
 
 	countriesFile, err := os.Open(countriesFilename)
 	if err != nil {
 		return err
 	}
+	defer countriesFile.Close()
 
 	countries := make([]string, 0)
 	scanner := bufio.NewScanner(countriesFile)
@@ -935,23 +2122,97 @@ func filterUsers() error {
 		countries = append(countries, line)
 	}
 
-	db, err := userdb.New(userdb.Abbreviate(false), userdb.FilterByCountries(countries...))
+	countries = expandCountryAliases(countries)
+
+	if fromURL != "" {
+		inUsersFilename, err = downloadFile(fromURL)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(inUsersFilename)
+	}
+
+	if uf.expectSHA256 != "" && inUsersFilename == "" {
+		return errors.New("-expect-sha256 needs <inUsersFile> or -from-url")
+	}
+
+	if inUsersFilename != "" {
+		source := inUsersFilename
+		if fromURL != "" {
+			source = fromURL
+		}
+		err = uf.verify(inUsersFilename, source)
+		if err != nil {
+			return err
+		}
+	}
+
+	var db *userdb.UsersDB
+	if inUsersFilename != "" {
+		db, err = usersFromFile(inUsersFilename, userdb.Abbreviate(false), userdb.FilterByCountries(countries...))
+	} else {
+		db, err = downloadUsers(userdb.Abbreviate(false), userdb.FilterByCountries(countries...))
+	}
 	if err != nil {
 		return err
 	}
-	if inUsersFilename != "" {
-		db.SetOptions(userdb.FromFile(inUsersFilename))
+
+	count, err := uo.writeUsersFile(db, outUsersFilename)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(count, "Users")
+	return nil
+}
+
+// versionInfo is the output of "version -json".
+type versionInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+
+	Dependencies []dependency `json:"dependencies,omitempty"`
+}
+
+// A dependency is a module compiled into dmrRadio.
+type dependency struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+// dependencies returns the modules compiled into dmrRadio, as recorded
+// by the Go toolchain.  A replaced module reports its replacement.
+func dependencies() []dependency {
+	info, ok := rtdebug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+
+	var deps []dependency
+	for _, mod := range info.Deps {
+		if mod.Replace != nil {
+			mod = mod.Replace
+		}
+		deps = append(deps, dependency{mod.Path, mod.Version})
 	}
 
-	fmt.Println(len(db.Users()), "Users")
-	return db.WriteMD380ToolsFile(outUsersFilename)
+	return deps
 }
 
 func printVersion() error {
+	var asJSON bool
+	var verbose bool
+
 	flags := flag.NewFlagSet("version", flag.ExitOnError)
+	flags.BoolVar(&asJSON, "json", false, "output the version and build information as JSON")
+	flags.BoolVar(&verbose, "verbose", false, "also output the versions of the modules compiled in")
 
 	flags.Usage = func() {
-		errorf("Usage: %s %s\n", os.Args[0], os.Args[1])
+		errorf("Usage: %s %s [-json] [-verbose]\n", os.Args[0], os.Args[1])
 		flags.PrintDefaults()
 		errorf("\nOutputs the version number of %s.\n", os.Args[0])
 		os.Exit(1)
@@ -963,14 +2224,71 @@ func printVersion() error {
 		flags.Usage()
 	}
 
+	if asJSON {
+		info := versionInfo{
+			Version:   version,
+			GitCommit: gitCommit,
+			BuildDate: buildDate,
+			GoVersion: runtime.Version(),
+			OS:        runtime.GOOS,
+			Arch:      runtime.GOARCH,
+		}
+		if verbose {
+			info.Dependencies = dependencies()
+		}
+
+		bytes, err := json.MarshalIndent(info, "", "\t")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(bytes))
+		return nil
+	}
+
 	fmt.Printf("%s\n", version)
+
+	if verbose {
+		for _, dep := range dependencies() {
+			fmt.Printf("\t%s %s\n", dep.Path, dep.Version)
+		}
+	}
+
 	return nil
 }
 
+// readOnlyEnv names the environment variable that, when set to a value
+// other than 0 or false, prevents the subcommands in radioWriters from
+// running, e.g. DMRRADIO_READONLY=1.
+const readOnlyEnv = "DMRRADIO_READONLY"
+
+// radioWriters are the subcommands that write to a radio.
+var radioWriters = map[string]bool{
+	"writecodeplug":      true,
+	"writemd380users":    true,
+	"writemd2017users":   true,
+	"writeuv380users":    true,
+	"writeusers":         true,
+	"writemd380firmware": true,
+}
+
+func readOnly() bool {
+	s := os.Getenv(readOnlyEnv)
+	if s == "" {
+		return false
+	}
+
+	ro, err := strconv.ParseBool(s)
+	return ro || err != nil
+}
+
 func main() {
 	log.SetPrefix(filepath.Base(os.Args[0]) + ": ")
 	log.SetFlags(log.Lshortfile)
 
+	installDownloadTransport()
+	parseGlobalFlags()
+
 	if len(os.Args) < 2 {
 		usage()
 	}
@@ -978,28 +2296,72 @@ func main() {
 	subCommandName := strings.ToLower(os.Args[1])
 
 	subCommands := map[string]func() error{
-		"newcodeplug":         newCodeplug,
-		"readcodeplug":        readCodeplug,
-		"writecodeplug":       writeCodeplug,
-		"readspiflash":        readSPIFlash,
-		"readmd380users":      readMD380Users,
-		"writemd380users":     writeMD380Users,
-		"writemd2017users":    writeMD2017Users,
-		"writeuv380users":     writeUV380Users,
-		"getusers":            getUsers,
-		"getabbreviatedusers": getAbbreviatedUsers,
-		"getmergedusers":      getMergedUsers,
-		"writemd380firmware":  writeMD380Firmware,
-		"texttocodeplug":      textToCodeplug,
-		"codeplugtotext":      codeplugToText,
-		"jsontocodeplug":      jsonToCodeplug,
-		"codeplugtojson":      codeplugToJSON,
-		"xlsxtocodeplug":      xlsxToCodeplug,
-		"codeplugtoxlsx":      codeplugToXLSX,
-		"usercountries":       userCountries,
-		"filterusers":         filterUsers,
-		"countrycounts":       countryCounts,
-		"version":             printVersion,
+		"newcodeplug":             newCodeplug,
+		"readcodeplug":            readCodeplug,
+		"writecodeplug":           writeCodeplug,
+		"readspiflash":            readSPIFlash,
+		"verifyspiflash":          verifySPIFlash,
+		"readmd380users":          readMD380Users,
+		"writemd380users":         writeMD380Users,
+		"writemd2017users":        writeMD2017Users,
+		"writeuv380users":         writeUV380Users,
+		"writeusers":              writeUsers,
+		"getusers":                getUsers,
+		"getabbreviatedusers":     getAbbreviatedUsers,
+		"getmergedusers":          getMergedUsers,
+		"writemd380firmware":      writeMD380Firmware,
+		"texttocodeplug":          textToCodeplug,
+		"codeplugtotext":          codeplugToText,
+		"jsontocodeplug":          jsonToCodeplug,
+		"codeplugtojson":          codeplugToJSON,
+		"xlsxtocodeplug":          xlsxToCodeplug,
+		"codeplugtoxlsx":          codeplugToXLSX,
+		"csvtocodeplug":           csvToCodeplug,
+		"codeplugtocsv":           codeplugToCSV,
+		"sanitizecodeplug":        sanitizeCodeplug,
+		"mergecodeplugs":          mergeCodeplugs,
+		"checkreferences":         checkReferences,
+		"reindex":                 reindex,
+		"hexdump":                 hexdump,
+		"fieldinfo":               fieldInfoCmd,
+		"comparemodels":           compareModels,
+		"modelmatrix":             modelMatrix,
+		"codeplugtojsondir":       codeplugToJSONDir,
+		"jsondirtocodeplug":       jsonDirToCodeplug,
+		"listcountryaliases":      listCountryAliases,
+		"listscanlists":           listScanLists,
+		"listtalkgroups":          listTalkgroups,
+		"jsonschema":              jsonSchema,
+		"frequencyranges":         frequencyRanges,
+		"listmodels":              listModels,
+		"batchconvert":            batchConvert,
+		"diffcodeplugs":           diffCodeplugs,
+		"diffdefaults":            diffDefaults,
+		"checkroundtrip":          checkRoundTrip,
+		"setdmrid":                setDMRID,
+		"setscanpriority":         setScanPriority,
+		"importcsv":               importCSV,
+		"exportcountriestemplate": exportCountriesTemplate,
+		"dedupezones":             dedupeZones,
+		"splitzones":              splitZones,
+		"sortzonechannels":        sortZoneChannels,
+		"setchannelfield":         setChannelField,
+		"readcodeplugtojson":      readCodeplugToJSON,
+		"readcodeplugtotext":      readCodeplugToText,
+		"readcodeplugtoxlsx":      readCodeplugToXLSX,
+		"validatecodeplug":        validateCodeplug,
+		"generatecontacts":        generateContacts,
+		"selftest":                selfTestCmd,
+		"testconnection":          testConnection,
+		"applyoverlay":            applyOverlay,
+		"channelstokml":           channelsToKML,
+		"explore":                 explore,
+		"exporttemplate":          exportTemplate,
+		"codepluginfo":            codeplugInfo,
+		"usercountries":           userCountries,
+		"filterusers":             filterUsers,
+		"countrycounts":           countryCounts,
+		"version":                 printVersion,
 	}
 
 	subCommand := subCommands[subCommandName]
@@ -1007,6 +2369,11 @@ func main() {
 		usage()
 	}
 
+	if radioWriters[subCommandName] && readOnly() {
+		errorf("%s writes to the radio, which is not allowed while %s is set\n", os.Args[1], readOnlyEnv)
+		os.Exit(1)
+	}
+
 	err := subCommand()
 	if err != nil {
 		errorf("%s\n", err.Error())
@@ -0,0 +1,523 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// A merger copies the records of one codeplug into another.
+type merger struct {
+	ed          *editor
+	cp          *codeplug.Codeplug
+	zoneMode    string
+	contactMode string
+	settings    bool
+	skipped     int
+	mergedByID  int
+
+	// renames maps the names of records of the other codeplug to the
+	// names of the records they were merged into, where they differ.
+	renames map[codeplug.RecordType]map[string]string
+}
+
+type recordPair struct {
+	dst *codeplug.Record
+	src *codeplug.Record
+}
+
+func (m *merger) addRecord(rType codeplug.RecordType, name string) (*codeplug.Record, error) {
+	if len(m.cp.Records(rType)) >= m.cp.MaxRecords(rType) {
+		return nil, fmt.Errorf("%s: too many records, the maximum is %d", rType, m.cp.MaxRecords(rType))
+	}
+
+	r := newRecord(m.cp, rType)
+	err := r.Field(ftName).SetString(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %s", rType, name, err.Error())
+	}
+
+	err = m.cp.AppendRecord(r)
+	if err != nil {
+		return nil, err
+	}
+
+	m.ed.record(r, "", "", "added")
+	return r, nil
+}
+
+func uniqueName(names map[string]*codeplug.Record, name string) string {
+	for i := 2; ; i++ {
+		newName := fmt.Sprintf("%s %d", name, i)
+		if names[newName] == nil {
+			return newName
+		}
+	}
+}
+
+func (m *merger) rename(rType codeplug.RecordType, from string, to string) {
+	if m.renames == nil {
+		m.renames = make(map[codeplug.RecordType]map[string]string)
+	}
+	if m.renames[rType] == nil {
+		m.renames[rType] = make(map[string]string)
+	}
+	m.renames[rType][from] = to
+}
+
+// value returns the value of field f of the other codeplug, with
+// references to records that were merged under another name renamed.
+func (m *merger) value(f *codeplug.Field) string {
+	value := f.String()
+	if to, ok := m.renames[f.ListRecordType()][value]; ok {
+		return to
+	}
+
+	return value
+}
+
+func isNumeric(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// preferredName returns the name to keep for two contacts with the
+// same call type and ID, named base in the base codeplug and other in
+// the other.
+func (m *merger) preferredName(base string, other string) string {
+	switch m.contactMode {
+	case "longest":
+		if len(other) > len(base) {
+			return other
+		}
+	case "non-numeric":
+		if isNumeric(base) && !isNumeric(other) {
+			return other
+		}
+	case "other":
+		return other
+	}
+
+	return base
+}
+
+// contactKey returns the call type and call ID of contact r, which
+// identify it across codeplugs, or "" if r has no call ID.  A private
+// call and a group call may share an ID.
+func contactKey(r *codeplug.Record) string {
+	id := r.Field(ftCallID)
+	if id == nil {
+		return ""
+	}
+
+	callType := ""
+	if f := r.Field(ftCallType); f != nil {
+		callType = f.String()
+	}
+
+	return callType + " " + id.String()
+}
+
+// mergeContactByID merges contact src of the other codeplug into the
+// base contact with the same call type and ID, if there is one, keeping
+// the preferred of their names.  It reports whether src was merged.
+func (m *merger) mergeContactByID(src *codeplug.Record, ids map[string]*codeplug.Record, names map[string]*codeplug.Record) (bool, error) {
+	key := contactKey(src)
+	if key == "" {
+		return false, nil
+	}
+
+	dst := ids[key]
+	if dst == nil {
+		return false, nil
+	}
+
+	oldName := dst.Name()
+	name := m.preferredName(oldName, src.Name())
+	if name != oldName && names[name] == nil {
+		// References are checked against the contact names, so
+		// rename the contact before pointing them at its new name.
+		err := m.ed.setField(dst.Field(ftName), name)
+		if err != nil {
+			return false, err
+		}
+		delete(names, oldName)
+		names[name] = dst
+
+		for _, ref := range references(m.cp) {
+			if ref.target == rtContacts && ref.field.String() == oldName {
+				err := m.ed.setField(ref.field, name)
+				if err != nil {
+					return false, err
+				}
+			}
+		}
+	}
+
+	if src.Name() != dst.Name() {
+		m.rename(rtContacts, src.Name(), dst.Name())
+	}
+	m.mergedByID++
+
+	return true, nil
+}
+
+// hasFieldType reports whether records of the type of r, which may be
+// of another model than the record fields come from, have fields of
+// type fType.
+func hasFieldType(r *codeplug.Record, fType codeplug.FieldType) bool {
+	for _, t := range r.AllFieldTypes() {
+		if t == fType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copyFields sets the fields of dst to the values of the fields of src,
+// except for the name field and fields dst's model lacks.
+func (m *merger) copyFields(dst *codeplug.Record, src *codeplug.Record) error {
+	for _, fType := range src.FieldTypes() {
+		if fType == ftName || !hasFieldType(dst, fType) {
+			continue
+		}
+
+		// NewField describes fType to dst, which MaxFields needs
+		// when dst has no fields of that type.
+		dst.NewField(fType)
+		if dst.MaxFields(fType) == 0 {
+			continue
+		}
+
+		srcFields := src.Fields(fType)
+		dstFields := dst.Fields(fType)
+
+		for i, srcF := range srcFields {
+			if i < len(dstFields) {
+				err := m.ed.setField(dstFields[i], m.value(srcF))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			if i >= dst.MaxFields(fType) {
+				break
+			}
+
+			err := m.addField(dst, fType, m.value(srcF))
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(dstFields) > len(srcFields) {
+			// RemoveField shifts the fields, so iterate over a copy.
+			for _, f := range append([]*codeplug.Field(nil), dstFields[len(srcFields):]...) {
+				m.ed.record(dst, f.TypeName(), f.String(), "")
+				dst.RemoveField(f)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *merger) addField(r *codeplug.Record, fType codeplug.FieldType, value string) error {
+	f := r.NewField(fType)
+	f.SetIndex(len(r.Fields(fType)))
+	err := f.SetString(value)
+	if err == nil && f.Index() >= r.MaxFields(fType) {
+		err = errors.New("too many fields")
+	}
+	if err == nil {
+		err = r.InsertField(f)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %s", recordName(r), f.TypeName(), err.Error())
+	}
+
+	m.ed.record(r, f.TypeName(), "", value)
+	return nil
+}
+
+// unionFields adds the values of the multi-valued fields of src that
+// are missing from dst, as long as dst has room for them.
+func (m *merger) unionFields(dst *codeplug.Record, src *codeplug.Record) error {
+	for _, fType := range src.FieldTypes() {
+		if !hasFieldType(dst, fType) {
+			continue
+		}
+
+		dst.NewField(fType)
+		max := dst.MaxFields(fType)
+		if max <= 1 {
+			continue
+		}
+
+		present := make(map[string]bool)
+		for _, f := range dst.Fields(fType) {
+			present[f.String()] = true
+		}
+
+		for _, srcF := range src.Fields(fType) {
+			value := m.value(srcF)
+			if present[value] {
+				continue
+			}
+
+			if len(dst.Fields(fType)) >= max {
+				err := warnf("%s: %s: no room for %s", recordName(dst), srcF.TypeName(), value)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			err := m.addField(dst, fType, value)
+			if err != nil {
+				return err
+			}
+			present[value] = true
+		}
+	}
+
+	return nil
+}
+
+// merge adds the records of other to m.cp.  Records of types that
+// m.cp's model lacks, and fields it lacks, are skipped.  Records of
+// types that have only a single instance, such as the general
+// settings, are not merged, but with m.settings, those of other
+// replace those of m.cp, except for the basic information, which
+// identifies the model.
+// New records are created before any fields are copied, so that
+// references between records of the other codeplug can be resolved.
+func (m *merger) merge(other *codeplug.Codeplug) error {
+	var copies []recordPair
+	var unions []recordPair
+
+	baseTypes := make(map[codeplug.RecordType]bool)
+	for _, rType := range m.cp.RecordTypes() {
+		baseTypes[rType] = true
+	}
+
+	for _, rType := range other.RecordTypes() {
+		if !baseTypes[rType] {
+			err := warnf("%s: not in the base codeplug's model, skipped", rType)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if m.cp.MaxRecords(rType) <= 1 {
+			dst := firstRecord(m.cp, rType)
+			src := firstRecord(other, rType)
+			if m.settings && rType != rtBasicInfo && dst != nil && src != nil {
+				copies = append(copies, recordPair{dst, src})
+			}
+			continue
+		}
+
+		names := recordsByName(m.cp, rType)
+
+		var ids map[string]*codeplug.Record
+		if rType == rtContacts && m.contactMode != "" {
+			ids = make(map[string]*codeplug.Record)
+			for _, r := range m.cp.Records(rType) {
+				if key := contactKey(r); key != "" {
+					ids[key] = r
+				}
+			}
+		}
+
+		for _, src := range other.Records(rType) {
+			if ids != nil {
+				merged, err := m.mergeContactByID(src, ids, names)
+				if err != nil {
+					return err
+				}
+				if merged {
+					continue
+				}
+			}
+
+			name := src.Name()
+			dst := names[name]
+
+			switch {
+			case dst == nil:
+
+			case rType == rtZones && m.zoneMode == "union":
+				unions = append(unions, recordPair{dst, src})
+				continue
+
+			case rType == rtZones && m.zoneMode == "replace":
+				copies = append(copies, recordPair{dst, src})
+				continue
+
+			case rType == rtZones && m.zoneMode == "rename":
+				name = uniqueName(names, name)
+				m.rename(rType, src.Name(), name)
+
+			default:
+				m.skipped++
+				continue
+			}
+
+			dst, err := m.addRecord(rType, name)
+			if err != nil {
+				return err
+			}
+			names[name] = dst
+			copies = append(copies, recordPair{dst, src})
+		}
+	}
+
+	for _, p := range copies {
+		err := m.copyFields(p.dst, p.src)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range unions {
+		err := m.unionFields(p.dst, p.src)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func mergeCodeplugs() error {
+	var ed editor
+	var zoneMode string
+	var contactMode string
+	settingsFrom := "base"
+
+	flags := flag.NewFlagSet("mergeCodeplugs", flag.ExitOnError)
+	flags.StringVar(&zoneMode, "zones", "rename", "handling of zones with the same name: rename, union, or replace")
+	flags.StringVar(&contactMode, "contacts-by-id", "", "merge contacts with the same call type and ID, keeping the longest, non-numeric, base, or other name")
+	flags.StringVar(&settingsFrom, "settings-from", settingsFrom, "codeplug whose general settings are kept: base, other, or either filename")
+	ed.addFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <baseCodeplugFilename> <codeplugFilename> <outCodeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nCreates <outCodeplugFilename>, containing the records of <baseCodeplugFilename>\n")
+		errorf("plus the records of <codeplugFilename>.  When both codeplugs contain a\n")
+		errorf("record with the same name, the record in <baseCodeplugFilename> is kept,\n")
+		errorf("except that same-named zones are handled as selected by -zones:\n")
+		errorf("\trename   the second zone is added under a new name\n")
+		errorf("\tunion    channels of the second zone are added to the first\n")
+		errorf("\treplace  the second zone replaces the first\n")
+		errorf("With -contacts-by-id, a contact with the same call type and ID as a\n")
+		errorf("contact in <baseCodeplugFilename> is merged into it, keeping the\n")
+		errorf("chosen name:\n")
+		errorf("\tlongest      the longer of the two names\n")
+		errorf("\tnon-numeric  the second name if the first is only digits\n")
+		errorf("\tbase         the name in <baseCodeplugFilename>\n")
+		errorf("\tother        the name in <codeplugFilename>\n")
+		errorf("The general settings, menu items, and other records of which a\n")
+		errorf("codeplug has only one are kept from <baseCodeplugFilename>, or with\n")
+		errorf("-settings-from other, taken from <codeplugFilename>.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 3 {
+		flags.Usage()
+	}
+	switch zoneMode {
+	case "rename", "union", "replace":
+	default:
+		errorf("bad -zones value\n\n")
+		flags.Usage()
+	}
+	switch contactMode {
+	case "", "longest", "non-numeric", "base", "other":
+	default:
+		errorf("bad -contacts-by-id value\n\n")
+		flags.Usage()
+	}
+	baseFilename := args[0]
+	otherFilename := args[1]
+	outFilename := args[2]
+	switch settingsFrom {
+	case baseFilename:
+		settingsFrom = "base"
+	case otherFilename:
+		settingsFrom = "other"
+	}
+	if settingsFrom != "base" && settingsFrom != "other" {
+		errorf("bad -settings-from value\n\n")
+		flags.Usage()
+	}
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, baseFilename)
+	if err != nil {
+		return err
+	}
+
+	other, err := loadCodeplug(codeplug.FileTypeNone, otherFilename)
+	if err != nil {
+		return err
+	}
+
+	m := &merger{
+		ed:          &ed,
+		cp:          cp,
+		zoneMode:    zoneMode,
+		contactMode: contactMode,
+		settings:    settingsFrom == "other",
+	}
+
+	err = m.merge(other)
+	if err != nil {
+		return err
+	}
+
+	if m.skipped != 0 {
+		err = warnf("%d records already in %s were not merged", m.skipped, baseFilename)
+		if err != nil {
+			return err
+		}
+	}
+	if m.mergedByID != 0 {
+		fmt.Printf("%d contacts were merged by call ID\n", m.mergedByID)
+	}
+
+	return ed.save(cp, outFilename)
+}
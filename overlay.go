@@ -0,0 +1,225 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// An overlayRecord holds the values of each field of a record in an
+// overlay file.
+type overlayRecord map[codeplug.FieldType][]string
+
+// readOverlay returns the records of each record type of cp in the JSON
+// overlay file.  The overlay has the form of a file written by
+// codeplugToJSON, but may contain only some record types, some records
+// of each, and some fields of each record.
+func readOverlay(cp *codeplug.Codeplug, overlayFilename string) (map[codeplug.RecordType][]overlayRecord, error) {
+	obj, err := readJSONObject(overlayFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		if name != string(rtBasicInfo) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	err = checkRecordTypes(cp, names)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", overlayFilename, err.Error())
+	}
+
+	overlay := make(map[codeplug.RecordType][]overlayRecord)
+	for _, rType := range cp.RecordTypes() {
+		raw, ok := obj[string(rType)]
+		if !ok || rType == rtBasicInfo {
+			continue
+		}
+
+		var objs []map[string]json.RawMessage
+		if json.Unmarshal(raw, &objs) != nil {
+			var one map[string]json.RawMessage
+			err = json.Unmarshal(raw, &one)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %s", overlayFilename, rType, err.Error())
+			}
+			objs = append(objs, one)
+		}
+
+		for _, fieldObjs := range objs {
+			rec := make(overlayRecord)
+			for name, raw := range fieldObjs {
+				var values []string
+				if json.Unmarshal(raw, &values) != nil {
+					var value string
+					err = json.Unmarshal(raw, &value)
+					if err != nil {
+						return nil, fmt.Errorf("%s: %s %s: %s", overlayFilename, rType, name, err.Error())
+					}
+					values = []string{value}
+				}
+				rec[codeplug.FieldType(name)] = values
+			}
+			overlay[rType] = append(overlay[rType], rec)
+		}
+	}
+
+	if len(overlay) == 0 {
+		return nil, fmt.Errorf("%s: no record types found", overlayFilename)
+	}
+
+	return overlay, nil
+}
+
+// overlayTarget returns the record of cp that rec applies to: the only
+// record of its type, or the record with its name, which is added if
+// there is none.
+func (m *merger) overlayTarget(rType codeplug.RecordType, rec overlayRecord) (*codeplug.Record, error) {
+	if m.cp.MaxRecords(rType) <= 1 {
+		return firstRecord(m.cp, rType), nil
+	}
+
+	names := rec[ftName]
+	if len(names) != 1 {
+		return nil, fmt.Errorf("%s: overlay record has no %s", rType, ftName)
+	}
+
+	r := recordsByName(m.cp, rType)[names[0]]
+	if r != nil {
+		return r, nil
+	}
+
+	return m.addRecord(rType, names[0])
+}
+
+// applyOverlayRecord sets the fields of r to the values in rec, in the
+// order of the record's fields, since some fields are validated against
+// those before them.
+func (m *merger) applyOverlayRecord(r *codeplug.Record, rec overlayRecord) error {
+	known := make(map[codeplug.FieldType]bool)
+	for _, fType := range r.AllFieldTypes() {
+		known[fType] = true
+
+		values, ok := rec[fType]
+		if !ok || fType == ftName {
+			continue
+		}
+
+		err := m.setFields(r, fType, values)
+		if err != nil {
+			return err
+		}
+	}
+
+	for fType := range rec {
+		if !known[fType] {
+			return fmt.Errorf("%s: unknown field %s", recordName(r), fType)
+		}
+	}
+
+	return nil
+}
+
+// overlayCodeplug applies each record of the JSON overlay file to cp.
+// Records missing from cp are added first, so that the overlay may
+// refer to them from records of any type.
+func (m *merger) overlayCodeplug(overlayFilename string) error {
+	overlay, err := readOverlay(m.cp, overlayFilename)
+	if err != nil {
+		return err
+	}
+
+	targets := make(map[codeplug.RecordType][]*codeplug.Record)
+	for _, rType := range m.cp.RecordTypes() {
+		for _, rec := range overlay[rType] {
+			r, err := m.overlayTarget(rType, rec)
+			if err != nil {
+				return err
+			}
+			targets[rType] = append(targets[rType], r)
+		}
+	}
+
+	for _, rType := range m.cp.RecordTypes() {
+		for i, rec := range overlay[rType] {
+			err = m.applyOverlayRecord(targets[rType][i], rec)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func applyOverlay() error {
+	var ed editor
+
+	flags := flag.NewFlagSet("applyOverlay", flag.ExitOnError)
+	ed.addFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <baseCodeplugFilename> <overlayJSONFilename> <outCodeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nCreates <outCodeplugFilename>, a copy of <baseCodeplugFilename> with the\n")
+		errorf("records in <overlayJSONFilename> applied.  The overlay is in the form\n")
+		errorf("written by codeplugToJSON, but need contain only the records to apply.\n")
+		errorf("The fields of each overlay record are set in the base record of the\n")
+		errorf("same type and name, which is added if there is none.  Other fields\n")
+		errorf("and records of the base are unchanged.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 3 {
+		flags.Usage()
+	}
+	baseFilename := args[0]
+	overlayFilename := args[1]
+	outFilename := args[2]
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, baseFilename)
+	if err != nil {
+		return err
+	}
+
+	m := &merger{ed: &ed, cp: cp}
+	err = m.overlayCodeplug(overlayFilename)
+	if err != nil {
+		return err
+	}
+
+	return ed.save(cp, outFilename)
+}
@@ -0,0 +1,240 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+const (
+	rtChannels        = codeplug.RecordType("Channels")
+	rtContacts        = codeplug.RecordType("Contacts")
+	rtZones           = codeplug.RecordType("Zones")
+	rtScanLists       = codeplug.RecordType("ScanLists")
+	rtGeneralSettings = codeplug.RecordType("GeneralSettings")
+	rtBasicInfo       = codeplug.RecordType("BasicInformation")
+)
+
+const ftName = codeplug.FieldType("Name")
+
+// codeplugModel returns the type and frequency range of cp, which has
+// not yet been loaded.  It must not be used on a loaded codeplug, since
+// identifying the model replaces the codeplug's basic information.
+func codeplugModel(cp *codeplug.Codeplug) (typ string, freqRange string, err error) {
+	types, freqs := cp.TypesFrequencyRanges()
+	if len(types) == 0 {
+		return "", "", errors.New("unknown model in codeplug")
+	}
+
+	typ = types[0]
+
+	if len(freqs[typ]) == 0 {
+		return "", "", errors.New("unknown frequency range in codeplug")
+	}
+
+	return typ, freqs[typ][0], nil
+}
+
+// loadedModel returns the type and frequency range of cp, which has
+// been loaded.
+func loadedModel(cp *codeplug.Codeplug) (typ string, freqRange string) {
+	return cp.Type(), cp.FrequencyRange()
+}
+
+// presentRecordTypes returns the record types of which cp has records.
+// Records cannot tell, since it creates a record of a type that has
+// none.
+func presentRecordTypes(cp *codeplug.Codeplug) map[codeplug.RecordType]bool {
+	present := make(map[codeplug.RecordType]bool)
+	for _, f := range cp.AllFields() {
+		present[f.Record().Type()] = true
+	}
+
+	return present
+}
+
+// newRecord returns an empty record of type rType that is not yet part
+// of cp.  The codeplug package exports no record constructor, so the
+// record is copied from the first existing one with its single-valued
+// fields reset to their defaults and its multi-valued fields removed.
+func newRecord(cp *codeplug.Codeplug, rType codeplug.RecordType) *codeplug.Record {
+	// Records creates a placeholder record when there are none;
+	// don't leave it behind.
+	placeholder := string(rType) + "1"
+	existed := cp.FindRecordByName(rType, placeholder) != nil
+	records := cp.Records(rType)
+	r := records[0].Copy()
+	if !existed && len(records) == 1 && records[0].Name() == placeholder {
+		cp.RemoveRecord(records[0])
+	}
+
+	for _, fType := range r.FieldTypes() {
+		fields := r.Fields(fType)
+		if r.MaxFields(fType) > 1 {
+			for _, f := range append([]*codeplug.Field(nil), fields...) {
+				r.RemoveField(f)
+			}
+			continue
+		}
+		for _, f := range fields {
+			f.SetDefault()
+		}
+	}
+
+	return r
+}
+
+func defaultCodeplug(typ string, freqRange string) (*codeplug.Codeplug, error) {
+	cp, err := codeplug.NewCodeplug(codeplug.FileTypeNew, "")
+	if err != nil {
+		return nil, err
+	}
+
+	err = cp.Load(typ, freqRange)
+	if err != nil {
+		return nil, err
+	}
+
+	return cp, nil
+}
+
+func firstRecord(cp *codeplug.Codeplug, rType codeplug.RecordType) *codeplug.Record {
+	records := cp.Records(rType)
+	if len(records) == 0 {
+		return nil
+	}
+
+	return records[0]
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+func recordsByName(cp *codeplug.Codeplug, rType codeplug.RecordType) map[string]*codeplug.Record {
+	names := make(map[string]*codeplug.Record)
+	for _, r := range cp.Records(rType) {
+		names[r.Name()] = r
+	}
+
+	return names
+}
+
+// A reference is a field whose value names a record.
+type reference struct {
+	field  *codeplug.Field
+	target codeplug.RecordType
+}
+
+func references(cp *codeplug.Codeplug) []reference {
+	var refs []reference
+	for _, rType := range cp.RecordTypes() {
+		for _, r := range cp.Records(rType) {
+			for _, fType := range r.FieldTypes() {
+				for _, f := range r.Fields(fType) {
+					target := f.ListRecordType()
+					if target != "" {
+						refs = append(refs, reference{f, target})
+					}
+				}
+			}
+		}
+	}
+
+	return refs
+}
+
+// danglingReferences returns the references in cp to records that do
+// not exist.  Values the field allows in place of a record name, such
+// as "None", are not dangling.
+func danglingReferences(cp *codeplug.Codeplug) []reference {
+	names := make(map[codeplug.RecordType]map[string]*codeplug.Record)
+
+	var dangling []reference
+	for _, ref := range references(cp) {
+		if names[ref.target] == nil {
+			names[ref.target] = recordsByName(cp, ref.target)
+		}
+
+		value := ref.field.String()
+		if names[ref.target][value] != nil {
+			continue
+		}
+
+		allowed := false
+		for _, s := range ref.field.Strings() {
+			if s == value {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			dangling = append(dangling, ref)
+		}
+	}
+
+	return dangling
+}
+
+// filterRecords removes the records of type rType from cp that do not
+// match the filter expression expr over their fields, returning the
+// number removed.  A field with several values matches as the values
+// joined by commas.
+func filterRecords(cp *codeplug.Codeplug, rType codeplug.RecordType, expr string) (int, error) {
+	var fields []string
+	for _, fType := range newRecord(cp, rType).AllFieldTypes() {
+		fields = append(fields, string(fType))
+	}
+
+	f, err := parseFilter(expr, fields)
+	if err != nil {
+		return 0, err
+	}
+
+	// RemoveRecord shifts the records, so iterate over a copy.
+	removed := 0
+	for _, r := range append([]*codeplug.Record(nil), cp.Records(rType)...) {
+		match := f.match(func(field string) string {
+			return strings.Join(fieldValues(r, codeplug.FieldType(field)), ",")
+		})
+		if !match {
+			cp.RemoveRecord(r)
+			removed++
+		}
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// roundTrip exports cp in format f, imports the result, and returns
+// the records that did not survive unchanged.
+func roundTrip(cp *codeplug.Codeplug, f format) ([]recordDiff, error) {
+	dir, err := ioutil.TempDir("", "roundtrip.")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "codeplug"+f.ext)
+	err = f.write(cp, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cp2, err := loadCodeplug(fileTypeOf(filename), filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffCodeplugRecords(cp, cp2), nil
+}
+
+func checkRoundTrip() error {
+	to := "json,text,xlsx"
+
+	flags := flag.NewFlagSet("checkRoundTrip", flag.ExitOnError)
+	flags.StringVar(&to, "formats", to, "comma-separated formats to check: "+strings.Join(formatNames(), ", "))
+	addIndexBaseFlag(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFile>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nConverts <codeplugFile> to each format and back, and reports\n")
+		errorf("every field whose value was lost or changed on the way.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
+	filename := args[0]
+
+	var names []string
+	for _, name := range splitList(to) {
+		if _, ok := formats[name]; !ok {
+			errorf("bad format: %s\n\n", name)
+			flags.Usage()
+		}
+		names = append(names, name)
+	}
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, name := range names {
+		diffs, err := roundTrip(cp, formats[name])
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err.Error())
+		}
+
+		fmt.Printf("%s: %s\n", name, diffStats(diffs))
+		printDiffs(diffs)
+		if len(diffs) != 0 {
+			failed++
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%s: %d formats do not round-trip", filename, failed)
+	}
+
+	return nil
+}
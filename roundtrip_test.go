@@ -0,0 +1,174 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// testModels returns each codeplug type with the first of its
+// frequency ranges.  Types whose default codeplug names a model that
+// belongs to another type are skipped, since their exports are
+// imported as that other type.
+func testModels(t *testing.T) [][2]string {
+	var models [][2]string
+	for typ, freqRanges := range codeplug.AllFrequencyRanges() {
+		if len(freqRanges) == 0 {
+			continue
+		}
+
+		cp, err := defaultCodeplug(typ, freqRanges[0])
+		if err != nil {
+			t.Fatalf("%s %s: %s", typ, freqRanges[0], err.Error())
+		}
+		if !containsString(cp.CodeplugInfo().Models, cp.Model()) {
+			continue
+		}
+
+		models = append(models, [2]string{typ, freqRanges[0]})
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i][0] < models[j][0]
+	})
+
+	return models
+}
+
+// populateCodeplug gives every record type of cp at least one record.
+// Records creates one from the codeplug's defaults when a type has
+// none, and it must exist before cp is exported, or the comparison
+// would create it in cp alone.  Text holding U+FFFF, the filler of
+// erased flash in some default codeplugs, is cleared, since XLSX files
+// cannot represent it.
+func populateCodeplug(cp *codeplug.Codeplug) {
+	for _, rType := range cp.RecordTypes() {
+		for _, r := range cp.Records(rType) {
+			for _, fType := range r.FieldTypes() {
+				for _, f := range r.Fields(fType) {
+					if strings.ContainsRune(f.String(), '\uffff') {
+						f.SetString("")
+					}
+				}
+			}
+		}
+	}
+}
+
+// randomizeCodeplug adds up to three copies of the first record of each
+// record type in cp, then sets each enumerated field to a value chosen
+// at random from the field's valid values.  Values the codeplug rejects
+// in the context of the record's other fields are left unchanged.  The
+// basic information is left alone, since it holds the model and
+// frequency range that the other values are validated against.
+func randomizeCodeplug(cp *codeplug.Codeplug, rnd *rand.Rand) {
+	populateCodeplug(cp)
+
+	for _, rType := range cp.RecordTypes() {
+		if rType == rtBasicInfo {
+			continue
+		}
+
+		first := cp.Records(rType)[0]
+		for n := rnd.Intn(4); n > 0; n-- {
+			if len(cp.Records(rType)) >= cp.MaxRecords(rType) {
+				break
+			}
+			cp.AppendRecord(first.Copy())
+		}
+
+		for _, r := range cp.Records(rType) {
+			for _, fType := range r.FieldTypes() {
+				for _, f := range r.Fields(fType) {
+					if !enumerated(f) {
+						continue
+					}
+					values := f.Strings()
+					if len(values) == 0 {
+						continue
+					}
+					f.SetString(values[rnd.Intn(len(values))])
+				}
+			}
+		}
+	}
+
+	// Revalidate, so that fields constrained by fields set after them,
+	// such as the bandwidth of a digital channel, hold legal values.
+	cp.Valid()
+}
+
+func testRoundTrip(t *testing.T, cp *codeplug.Codeplug, name string) {
+	for _, fName := range []string{"json", "text", "xlsx"} {
+		diffs, err := roundTrip(cp, formats[fName])
+		if err != nil {
+			t.Errorf("%s: %s: %s", name, fName, err.Error())
+			continue
+		}
+
+		for _, d := range diffs {
+			if d.kind != diffChanged {
+				t.Errorf("%s: %s: %s %s: %s", name, fName, d.rType, d.name, d.kind)
+			}
+			for _, f := range d.fields {
+				t.Errorf("%s: %s: %s %s: %s: %q became %q", name, fName, d.rType, d.name, f.name, f.a, f.b)
+			}
+		}
+	}
+}
+
+func TestRoundTripDefault(t *testing.T) {
+	for _, model := range testModels(t) {
+		cp, err := defaultCodeplug(model[0], model[1])
+		if err != nil {
+			t.Fatalf("%s %s: %s", model[0], model[1], err.Error())
+		}
+
+		populateCodeplug(cp)
+		testRoundTrip(t, cp, model[0])
+	}
+}
+
+func TestRoundTripRandom(t *testing.T) {
+	seeds := 3
+	if testing.Short() {
+		seeds = 1
+	}
+
+	for _, model := range testModels(t) {
+		for seed := 1; seed <= seeds; seed++ {
+			cp, err := defaultCodeplug(model[0], model[1])
+			if err != nil {
+				t.Fatalf("%s %s: %s", model[0], model[1], err.Error())
+			}
+
+			randomizeCodeplug(cp, rand.New(rand.NewSource(int64(seed))))
+			testRoundTrip(t, cp, model[0])
+		}
+	}
+}
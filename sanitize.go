@@ -0,0 +1,128 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// personalFields are the general settings fields reset by sanitizeCodeplug.
+var personalFields = []string{
+	"RadioName",
+	"RadioID",
+	"RadioID1",
+	"RadioID2",
+	"RadioID3",
+	"IntroScreenLine1",
+	"IntroScreenLine2",
+}
+
+func sanitizeCodeplug() error {
+	var keep string
+	var alsoStrip string
+	var ed editor
+
+	flags := flag.NewFlagSet("sanitizeCodeplug", flag.ExitOnError)
+	flags.StringVar(&keep, "keep", "", "comma-separated general settings fields to leave unchanged")
+	flags.StringVar(&alsoStrip, "also-strip", "", "comma-separated general settings fields to reset in addition to the defaults")
+	ed.addFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <inCodeplugFilename> <outCodeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nCreates <outCodeplugFilename>, a copy of the codeplug in <inCodeplugFilename>\n")
+		errorf("with personal general settings reset to their default values.\n")
+		errorf("By default, these fields are reset:\n")
+		for _, name := range personalFields {
+			errorf("\t%s\n", name)
+		}
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 2 {
+		flags.Usage()
+	}
+	inFilename := args[0]
+	outFilename := args[1]
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, inFilename)
+	if err != nil {
+		return err
+	}
+
+	typ, freqRange := loadedModel(cp)
+	defaultCp, err := defaultCodeplug(typ, freqRange)
+	if err != nil {
+		return err
+	}
+
+	r := firstRecord(cp, rtGeneralSettings)
+	defaultR := firstRecord(defaultCp, rtGeneralSettings)
+	if r == nil || defaultR == nil {
+		return fmt.Errorf("%s: no general settings", inFilename)
+	}
+
+	kept := make(map[string]bool)
+	for _, name := range splitList(keep) {
+		if r.Field(codeplug.FieldType(name)) == nil {
+			return fmt.Errorf("unknown general settings field: %s", name)
+		}
+		kept[name] = true
+	}
+
+	var names []string
+	names = append(names, personalFields...)
+	for _, name := range splitList(alsoStrip) {
+		if r.Field(codeplug.FieldType(name)) == nil {
+			return fmt.Errorf("unknown general settings field: %s", name)
+		}
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		if kept[name] {
+			continue
+		}
+
+		fType := codeplug.FieldType(name)
+		f := r.Field(fType)
+		defaultF := defaultR.Field(fType)
+		if f == nil || defaultF == nil {
+			continue
+		}
+
+		err = ed.setField(f, defaultF.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	return ed.save(cp, outFilename)
+}
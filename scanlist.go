@@ -0,0 +1,251 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+const (
+	ftPriorityChannel1 = codeplug.FieldType("PriorityChannel1")
+	ftPriorityChannel2 = codeplug.FieldType("PriorityChannel2")
+	ftChannel          = codeplug.FieldType("Channel")
+	ftChannelA         = codeplug.FieldType("ChannelA")
+	ftChannelB         = codeplug.FieldType("ChannelB")
+)
+
+// memberFieldTypes returns the types of the fields of r, a zone or a
+// scan list, that name its channels.  Scan lists and the zones of most
+// models use Channel, while the zones of dual-band models keep separate
+// ChannelA and ChannelB lists.
+func memberFieldTypes(r *codeplug.Record) []codeplug.FieldType {
+	var fTypes []codeplug.FieldType
+	for _, fType := range r.AllFieldTypes() {
+		switch fType {
+		case ftChannel, ftChannelA, ftChannelB:
+			fTypes = append(fTypes, fType)
+		}
+	}
+
+	return fTypes
+}
+
+// channelMembers returns the names of the channels in zone or scan
+// list r.  A channel in both lists of a dual-band zone appears twice.
+func channelMembers(r *codeplug.Record) []string {
+	var names []string
+	for _, fType := range memberFieldTypes(r) {
+		names = append(names, fieldValues(r, fType)...)
+	}
+
+	return names
+}
+
+// setPriorityChannel sets the priority channel field fType of scan list
+// r in cp to channel, which must be a member of r or a value the field
+// allows in place of a channel name, such as "None".
+func (e *editor) setPriorityChannel(cp *codeplug.Codeplug, r *codeplug.Record, fType codeplug.FieldType, channel string) error {
+	f := r.Field(fType)
+	if f == nil {
+		return fmt.Errorf("%s: no %s field", recordName(r), fType)
+	}
+
+	for _, s := range f.Strings() {
+		if s == channel {
+			return e.setField(f, channel)
+		}
+	}
+
+	if recordsByName(cp, rtChannels)[channel] == nil {
+		return fmt.Errorf("no channel named %q", channel)
+	}
+
+	for _, member := range channelMembers(r) {
+		if member == channel {
+			return e.setField(f, channel)
+		}
+	}
+
+	return fmt.Errorf("channel %q is not a member of %s", channel, recordName(r))
+}
+
+func setScanPriority() error {
+	var priority1 string
+	var priority2 string
+	var ed editor
+
+	flags := flag.NewFlagSet("setScanPriority", flag.ExitOnError)
+	flags.StringVar(&priority1, "priority1", "", "name of the first priority channel")
+	flags.StringVar(&priority2, "priority2", "", "name of the second priority channel")
+	ed.addFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s -priority1 <channel> -priority2 <channel> <codeplugFilename> <scanListName>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nSets the priority channels of the scan list named <scanListName>\n")
+		errorf("in <codeplugFilename>.  Each channel must be a member of the scan list.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 2 || (priority1 == "" && priority2 == "") {
+		flags.Usage()
+	}
+	filename := args[0]
+	scanListName := args[1]
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	r := recordsByName(cp, rtScanLists)[scanListName]
+	if r == nil {
+		return fmt.Errorf("%s: no scan list named %q", filename, scanListName)
+	}
+
+	if priority1 != "" {
+		err = ed.setPriorityChannel(cp, r, ftPriorityChannel1, priority1)
+		if err != nil {
+			return err
+		}
+	}
+
+	if priority2 != "" {
+		err = ed.setPriorityChannel(cp, r, ftPriorityChannel2, priority2)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ed.save(cp, filename)
+}
+
+// A scanListReport is a scan list, its channels and priority channels,
+// and the channels it names that do not exist.
+type scanListReport struct {
+	Name             string   `json:"name"`
+	Channels         []string `json:"channels"`
+	PriorityChannels []string `json:"priorityChannels"`
+	Missing          []string `json:"missing"`
+}
+
+// scanLists returns a report of each scan list in cp.
+func scanLists(cp *codeplug.Codeplug) []*scanListReport {
+	channels := recordsByName(cp, rtChannels)
+	reports := []*scanListReport{}
+
+	for _, r := range cp.Records(rtScanLists) {
+		report := &scanListReport{
+			Name:             r.Name(),
+			Channels:         []string{},
+			PriorityChannels: []string{},
+			Missing:          []string{},
+		}
+
+		for _, name := range channelMembers(r) {
+			report.Channels = append(report.Channels, name)
+			if channels[name] == nil && !containsString(report.Missing, name) {
+				report.Missing = append(report.Missing, name)
+			}
+		}
+
+		for _, fType := range []codeplug.FieldType{ftPriorityChannel1, ftPriorityChannel2} {
+			f := r.Field(fType)
+			if f == nil {
+				continue
+			}
+			name := f.String()
+			if channels[name] == nil && containsString(f.Strings(), name) {
+				continue
+			}
+
+			report.PriorityChannels = append(report.PriorityChannels, name)
+			if channels[name] == nil && !containsString(report.Missing, name) {
+				report.Missing = append(report.Missing, name)
+			}
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports
+}
+
+func listScanLists() error {
+	var asJSON bool
+
+	flags := flag.NewFlagSet("listScanLists", flag.ExitOnError)
+	flags.BoolVar(&asJSON, "json", false, "print the scan lists as JSON")
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nLists each scan list in <codeplugFilename> with its channels and\n")
+		errorf("priority channels, flagging the channels it names that do not exist.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, args[0])
+	if err != nil {
+		return err
+	}
+
+	reports := scanLists(cp)
+
+	if asJSON {
+		bytes, err := json.MarshalIndent(reports, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bytes))
+		return nil
+	}
+
+	for _, report := range reports {
+		fmt.Println(report.Name)
+		fmt.Printf("\tchannels: %s\n", strings.Join(report.Channels, ", "))
+		if len(report.PriorityChannels) != 0 {
+			fmt.Printf("\tpriority channels: %s\n", strings.Join(report.PriorityChannels, ", "))
+		}
+		if len(report.Missing) != 0 {
+			fmt.Printf("\tmissing channels: %s\n", strings.Join(report.Missing, ", "))
+		}
+	}
+
+	return nil
+}
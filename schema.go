@@ -0,0 +1,589 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+type fieldInfo struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	MaxCount   int      `json:"maxCount"`
+	Default    string   `json:"default"`
+	Values     []string `json:"values,omitempty"`
+	References string   `json:"references,omitempty"`
+}
+
+type recordInfo struct {
+	Name       string      `json:"name"`
+	MaxRecords int         `json:"maxRecords"`
+	Fields     []fieldInfo `json:"fields"`
+}
+
+type modelInfo struct {
+	Model       string       `json:"model"`
+	FreqRange   string       `json:"freqRange"`
+	RecordTypes []recordInfo `json:"recordTypes"`
+}
+
+// schema describes the record types and fields of a default codeplug
+// for the given model and frequency range.
+func schema(typ string, freqRange string) (*modelInfo, error) {
+	cp, err := defaultCodeplug(typ, freqRange)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &modelInfo{
+		Model:     typ,
+		FreqRange: freqRange,
+	}
+
+	for _, rType := range cp.RecordTypes() {
+		r := firstRecord(cp, rType)
+		if r == nil {
+			r = newRecord(cp, rType)
+		}
+
+		rInfo := recordInfo{
+			Name:       string(rType),
+			MaxRecords: cp.MaxRecords(rType),
+		}
+
+		for _, fType := range r.AllFieldTypes() {
+			f := r.NewField(fType)
+			if fields := r.Fields(fType); len(fields) != 0 {
+				f = fields[0]
+			}
+
+			fInfo := fieldInfo{
+				Name:     string(fType),
+				Type:     string(f.ValueType()),
+				MaxCount: r.MaxFields(fType),
+			}
+			fInfo.Default = f.String()
+			fInfo.References = string(f.ListRecordType())
+			if fInfo.References == "" && enumerated(f) {
+				fInfo.Values = f.Strings()
+			}
+
+			rInfo.Fields = append(rInfo.Fields, fInfo)
+		}
+
+		info.RecordTypes = append(info.RecordTypes, rInfo)
+	}
+
+	return info, nil
+}
+
+// enumerated returns true if f takes one of a fixed list of values.
+// Strings may only be called for such fields; codeplug exits on others.
+func enumerated(f *codeplug.Field) bool {
+	switch f.ValueType() {
+	case codeplug.VtBandwidth, codeplug.VtCallType, codeplug.VtCtcssDcs,
+		codeplug.VtIndexedStrings, codeplug.VtIStrings,
+		codeplug.VtPrivacyNumber, codeplug.VtRadioButton,
+		codeplug.VtSpanList:
+		return true
+	}
+
+	return false
+}
+
+func fieldInfoCmd() error {
+	var typ string
+	var freq string
+
+	flags := flag.NewFlagSet("fieldInfo", flag.ExitOnError)
+	addModelFlags(flags, &typ, &freq)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s -model <modelName> -freq <freqRange>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nOutputs, as JSON, each record type of the given radio model\n")
+		errorf("with its fields, their value types, their default values, and\n")
+		errorf("their valid values.  Byte layout is not included, as the codeplug\n")
+		errorf("package does not export it.\n\n")
+		printModelsUsage()
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 0 {
+		flags.Usage()
+	}
+	checkModelFlags(flags, &typ, &freq)
+
+	info, err := schema(typ, freq)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := json.MarshalIndent(info, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(bytes))
+	return nil
+}
+
+func (info *modelInfo) recordInfo(name string) *recordInfo {
+	for i := range info.RecordTypes {
+		if info.RecordTypes[i].Name == name {
+			return &info.RecordTypes[i]
+		}
+	}
+
+	return nil
+}
+
+func (info *recordInfo) fieldInfo(name string) *fieldInfo {
+	for i := range info.Fields {
+		if info.Fields[i].Name == name {
+			return &info.Fields[i]
+		}
+	}
+
+	return nil
+}
+
+func compareModels() error {
+	var freqA string
+	var freqB string
+
+	flags := flag.NewFlagSet("compareModels", flag.ExitOnError)
+	flags.StringVar(&freqA, "freqA", "", "<frequency range> of modelA (default: its first range)")
+	flags.StringVar(&freqB, "freqB", "", "<frequency range> of modelB (default: its first range)")
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <modelA> <modelB>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nLists the record types and fields present in only one of the two\n")
+		errorf("radio models, and the record and field limits that differ.\n\n")
+		printModelsUsage()
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 2 {
+		flags.Usage()
+	}
+	typA := args[0]
+	typB := args[1]
+
+	typA = canonicalModelName(typA)
+	typB = canonicalModelName(typB)
+	typeFreqs := codeplug.AllFrequencyRanges()
+	if freqA == "" && len(typeFreqs[typA]) != 0 {
+		freqA = typeFreqs[typA][0]
+	}
+	if freqB == "" && len(typeFreqs[typB]) != 0 {
+		freqB = typeFreqs[typB][0]
+	}
+	checkModelFlags(flags, &typA, &freqA)
+	checkModelFlags(flags, &typB, &freqB)
+
+	infoA, err := schema(typA, freqA)
+	if err != nil {
+		return err
+	}
+
+	infoB, err := schema(typB, freqB)
+	if err != nil {
+		return err
+	}
+
+	for _, rA := range infoA.RecordTypes {
+		rB := infoB.recordInfo(rA.Name)
+		if rB == nil {
+			fmt.Printf("%s: only in %s\n", rA.Name, typA)
+			continue
+		}
+
+		if rA.MaxRecords != rB.MaxRecords {
+			fmt.Printf("%s: at most %d records in %s, %d in %s\n", rA.Name, rA.MaxRecords, typA, rB.MaxRecords, typB)
+		}
+
+		for _, fA := range rA.Fields {
+			fB := rB.fieldInfo(fA.Name)
+			if fB == nil {
+				fmt.Printf("%s %s: only in %s\n", rA.Name, fA.Name, typA)
+				continue
+			}
+
+			if fA.MaxCount != fB.MaxCount {
+				fmt.Printf("%s %s: at most %d in %s, %d in %s\n", rA.Name, fA.Name, fA.MaxCount, typA, fB.MaxCount, typB)
+			}
+		}
+
+		for _, fB := range rB.Fields {
+			if rA.fieldInfo(fB.Name) == nil {
+				fmt.Printf("%s %s: only in %s\n", rA.Name, fB.Name, typB)
+			}
+		}
+	}
+
+	for _, rB := range infoB.RecordTypes {
+		if infoA.recordInfo(rB.Name) == nil {
+			fmt.Printf("%s: only in %s\n", rB.Name, typB)
+		}
+	}
+
+	return nil
+}
+
+// jsonSchemaObject is a JSON Schema, as emitted by the jsonSchema
+// subcommand.
+type jsonSchemaObject map[string]interface{}
+
+func fieldJSONSchema(f fieldInfo) jsonSchemaObject {
+	s := jsonSchemaObject{"type": "string"}
+	if len(f.Values) != 0 {
+		s["enum"] = f.Values
+	}
+	if f.References != "" {
+		s["description"] = "name of a " + f.References + " record"
+	}
+
+	if f.MaxCount <= 1 {
+		return s
+	}
+
+	return jsonSchemaObject{
+		"type":     "array",
+		"items":    s,
+		"maxItems": f.MaxCount,
+	}
+}
+
+func recordJSONSchema(r recordInfo) jsonSchemaObject {
+	properties := make(map[string]jsonSchemaObject)
+	for _, f := range r.Fields {
+		properties[f.Name] = fieldJSONSchema(f)
+	}
+
+	s := jsonSchemaObject{
+		"type":       "object",
+		"properties": properties,
+	}
+
+	if r.MaxRecords <= 1 {
+		return s
+	}
+
+	return jsonSchemaObject{
+		"type":     "array",
+		"items":    s,
+		"maxItems": r.MaxRecords,
+	}
+}
+
+func jsonSchema() error {
+	var typ string
+	var freq string
+
+	flags := flag.NewFlagSet("jsonSchema", flag.ExitOnError)
+	addModelFlags(flags, &typ, &freq)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s -model <modelName> -freq <freqRange>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nOutputs a JSON Schema describing the JSON codeplug files of the\n")
+		errorf("given radio model, as written by codeplugToJSON.\n\n")
+		printModelsUsage()
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 0 {
+		flags.Usage()
+	}
+	checkModelFlags(flags, &typ, &freq)
+
+	info, err := schema(typ, freq)
+	if err != nil {
+		return err
+	}
+
+	properties := make(map[string]jsonSchemaObject)
+	for _, r := range info.RecordTypes {
+		properties[r.Name] = recordJSONSchema(r)
+	}
+
+	s := jsonSchemaObject{
+		"$schema":    "http://json-schema.org/draft-07/schema#",
+		"title":      fmt.Sprintf("%s %s codeplug", typ, freq),
+		"type":       "object",
+		"properties": properties,
+	}
+
+	bytes, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(bytes))
+	return nil
+}
+
+func frequencyRanges() error {
+	var typ string
+	var asJSON bool
+
+	flags := flag.NewFlagSet("frequencyRanges", flag.ExitOnError)
+	flags.StringVar(&typ, "model", "", "<model name> (default: all models)")
+	flags.BoolVar(&asJSON, "json", false, "output as JSON")
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s [-model <modelName>] [-json]\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nLists the valid frequency ranges of a radio model, or of all models.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 0 {
+		flags.Usage()
+	}
+
+	types, freqs := allTypesFrequencyRanges()
+	if typ != "" {
+		typ = canonicalModelName(typ)
+		if freqs[typ] == nil {
+			errorf("bad modelName\n\n")
+			flags.Usage()
+		}
+		types = []string{typ}
+	}
+
+	if asJSON {
+		selected := make(map[string][]string)
+		for _, typ := range types {
+			selected[typ] = freqs[typ]
+		}
+
+		bytes, err := json.MarshalIndent(selected, "", "\t")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(bytes))
+		return nil
+	}
+
+	for _, typ := range types {
+		if len(types) == 1 {
+			for _, freq := range freqs[typ] {
+				fmt.Println(freq)
+			}
+			continue
+		}
+
+		fmt.Println(typ)
+		for _, freq := range freqs[typ] {
+			fmt.Printf("\t%s\n", freq)
+		}
+	}
+
+	return nil
+}
+
+func listModels() error {
+	var pretty bool
+
+	flags := flag.NewFlagSet("listModels", flag.ExitOnError)
+	flags.BoolVar(&pretty, "pretty", false, "indent the JSON output")
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s [-pretty]\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nPrints a JSON object mapping the name of each supported radio\n")
+		errorf("model to an array of its frequency ranges.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 0 {
+		flags.Usage()
+	}
+
+	models := make(map[string][]string)
+	for typ, freqs := range codeplug.AllFrequencyRanges() {
+		if freqs == nil {
+			freqs = []string{}
+		}
+		models[typ] = freqs
+	}
+
+	var bytes []byte
+	var err error
+	if pretty {
+		bytes, err = json.MarshalIndent(models, "", "\t")
+	} else {
+		bytes, err = json.Marshal(models)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(bytes))
+	return nil
+}
+
+// capabilityRows returns the rows of the model capability matrix of
+// infos: for each record type, the maximum number of records of it in
+// each model, or "" if the model lacks it.  With fields, a row follows
+// for each field of the type that some model having the type lacks.
+func capabilityRows(infos []*modelInfo, fields bool) [][]string {
+	var rows [][]string
+
+	var rNames []string
+	seen := make(map[string]bool)
+	for _, info := range infos {
+		for _, r := range info.RecordTypes {
+			if !seen[r.Name] {
+				seen[r.Name] = true
+				rNames = append(rNames, r.Name)
+			}
+		}
+	}
+
+	for _, rName := range rNames {
+		row := []string{rName}
+		var fNames []string
+		fSeen := make(map[string]bool)
+		for _, info := range infos {
+			r := info.recordInfo(rName)
+			if r == nil {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, fmt.Sprint(r.MaxRecords))
+			for _, f := range r.Fields {
+				if !fSeen[f.Name] {
+					fSeen[f.Name] = true
+					fNames = append(fNames, f.Name)
+				}
+			}
+		}
+		rows = append(rows, row)
+
+		if !fields {
+			continue
+		}
+
+		for _, fName := range fNames {
+			row := []string{rName + " " + fName}
+			common := true
+			for _, info := range infos {
+				r := info.recordInfo(rName)
+				switch {
+				case r == nil:
+					row = append(row, "")
+				case r.fieldInfo(fName) == nil:
+					row = append(row, "")
+					common = false
+				default:
+					row = append(row, "yes")
+				}
+			}
+			if !common {
+				rows = append(rows, row)
+			}
+		}
+	}
+
+	return rows
+}
+
+func modelMatrix() error {
+	var format string
+	var fields bool
+
+	flags := flag.NewFlagSet("modelMatrix", flag.ExitOnError)
+	flags.StringVar(&format, "format", "markdown", "format of the matrix: markdown or csv")
+	flags.BoolVar(&fields, "fields", false, "also list the fields that only some models have")
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s [-format markdown|csv] [-fields]\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nOutputs a matrix with a column for each supported radio model and\n")
+		errorf("a row for each record type, giving the maximum number of records of\n")
+		errorf("that type, or nothing if the model lacks it.  With -fields, the\n")
+		errorf("fields of each type that some of its models lack are listed too.\n")
+		errorf("Each model is described by its first frequency range.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 0 || (format != "markdown" && format != "csv") {
+		flags.Usage()
+	}
+
+	types, freqs := allTypesFrequencyRanges()
+	var infos []*modelInfo
+	header := []string{"Record type"}
+	for _, typ := range types {
+		if len(freqs[typ]) == 0 {
+			continue
+		}
+
+		info, err := schema(typ, freqs[typ][0])
+		if err != nil {
+			return err
+		}
+		infos = append(infos, info)
+		header = append(header, typ)
+	}
+
+	rows := append([][]string{header}, capabilityRows(infos, fields)...)
+
+	if format == "csv" {
+		return csv.NewWriter(os.Stdout).WriteAll(rows)
+	}
+
+	for i, row := range rows {
+		fmt.Printf("| %s |\n", strings.Join(row, " | "))
+		if i == 0 {
+			fmt.Printf("|%s\n", strings.Repeat(" --- |", len(row)))
+		}
+	}
+
+	return nil
+}
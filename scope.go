@@ -0,0 +1,157 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// A channelScope selects the channels changed by a bulk edit.
+// -all, the default, selects every channel.  -zone and -freq may be
+// combined to select the channels of a zone that lie within a band;
+// neither may be combined with -all.
+type channelScope struct {
+	all  bool
+	zone string
+	freq string
+}
+
+func (s *channelScope) addFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&s.all, "all", false, "change every channel (the default)")
+	flags.StringVar(&s.zone, "zone", "", "change only the channels in this zone")
+	flags.StringVar(&s.freq, "freq", "", "change only the channels receiving within this band, e.g. 144-148 (MHz)")
+}
+
+func printScopeUsage() {
+	errorf("\nWithout -zone or -freq, every channel is changed.  -zone and -freq\n")
+	errorf("together select the channels of the zone within the band.\n")
+	errorf("-all may not be combined with either.\n")
+}
+
+// channels returns the channels of cp selected by s, in codeplug order.
+func (s *channelScope) channels(cp *codeplug.Codeplug) ([]*codeplug.Record, error) {
+	if s.all && (s.zone != "" || s.freq != "") {
+		return nil, errors.New("-all may not be combined with -zone or -freq")
+	}
+
+	var bands []band
+	if s.freq != "" {
+		bands = frequencyBands(s.freq)
+		if len(bands) == 0 {
+			return nil, fmt.Errorf("bad frequency band: %s", s.freq)
+		}
+	}
+
+	var members map[string]bool
+	if s.zone != "" {
+		zone := recordsByName(cp, rtZones)[s.zone]
+		if zone == nil {
+			return nil, fmt.Errorf("no zone named %q", s.zone)
+		}
+
+		members = make(map[string]bool)
+		for _, name := range channelMembers(zone) {
+			members[name] = true
+		}
+	}
+
+	var channels []*codeplug.Record
+	for _, r := range cp.Records(rtChannels) {
+		if members != nil && !members[r.Name()] {
+			continue
+		}
+
+		if bands != nil {
+			f := r.Field(ftRxFrequency)
+			if f == nil {
+				continue
+			}
+			freq, err := strconv.ParseFloat(f.String(), 64)
+			if err != nil || !inBands(freq, bands) {
+				continue
+			}
+		}
+
+		channels = append(channels, r)
+	}
+
+	return channels, nil
+}
+
+func setChannelField() error {
+	var scope channelScope
+	var ed editor
+
+	flags := flag.NewFlagSet("setChannelField", flag.ExitOnError)
+	scope.addFlags(flags)
+	ed.addFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s [-all | -zone <name> | -freq <band>] <codeplugFilename> <field> <value>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nSets <field> of the selected channels in <codeplugFilename> to\n")
+		errorf("<value>, e.g. Power High or ColorCode 1.\n")
+		printScopeUsage()
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 3 {
+		flags.Usage()
+	}
+	filename := args[0]
+	fType := codeplug.FieldType(args[1])
+	value := args[2]
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	channels, err := scope.channels(cp)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range channels {
+		f := r.Field(fType)
+		if f == nil {
+			return fmt.Errorf("%s: no %s field", recordName(r), fType)
+		}
+
+		err = ed.setField(f, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ed.save(cp, filename)
+}
@@ -0,0 +1,199 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+
+	"github.com/dalefarnsworth-dmr/dfu"
+)
+
+// defaultSelfTestURLs are checked for reachability by selftest.
+var defaultSelfTestURLs = []string{
+	"https://radioid.net/",
+}
+
+// dfuHint suggests how to fix a failure to open the radio.
+const dfuHint = "check that the radio is on in DFU mode (hold PTT and the button above it while\n" +
+	"\t  turning it on), that the cable is a programming cable, and that the USB\n" +
+	"\t  driver is installed (Windows) or the device is accessible (Linux udev rules)"
+
+// openDFU opens and closes the radio's DFU device, writing nothing.
+func openDFU() error {
+	df, err := dfu.New(func(int) error { return nil })
+	if err != nil {
+		return err
+	}
+	df.Close()
+
+	return nil
+}
+
+// checkWritableDir reports whether a file can be created in dir.
+func checkWritableDir(dir string) error {
+	tmp, err := ioutil.TempFile(dir, "selftest.*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+
+	return os.Remove(tmp.Name())
+}
+
+func checkURL(url string) error {
+	resp, err := downloadClient.Head(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// A selfTest is one check made by selftest.
+type selfTest struct {
+	name  string
+	check func() error
+	hint  string
+	radio bool
+}
+
+func selfTests(urls []string) []selfTest {
+	tests := []selfTest{
+		{"temporary directory " + os.TempDir(), func() error {
+			return checkWritableDir(os.TempDir())
+		}, "set TMPDIR (TEMP on Windows) to a writable directory", false},
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err == nil {
+		tests = append(tests, selfTest{"cache directory " + cacheDir, func() error {
+			return checkWritableDir(cacheDir)
+		}, "check the permissions of " + cacheDir, false})
+	}
+
+	for _, url := range urls {
+		url := url
+		tests = append(tests, selfTest{"network access to " + url, func() error {
+			return checkURL(url)
+		}, "check the network connection and any proxy settings (HTTPS_PROXY)", false})
+	}
+
+	tests = append(tests, selfTest{"radio in DFU mode", openDFU, dfuHint, true})
+
+	return tests
+}
+
+func selfTestCmd() error {
+	var url string
+	var skipRadio bool
+
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	flags.StringVar(&url, "url", "", "check network access to this URL instead of the user database sources")
+	flags.BoolVar(&skipRadio, "skip-radio", false, "do not check for a radio")
+	addDownloadFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nChecks that %s can create files, reach the network, and open\n", os.Args[0])
+		errorf("a radio in DFU mode, and prints a report to include in bug reports.\n")
+		errorf("Nothing is written to the radio.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 0 {
+		flags.Usage()
+	}
+
+	urls := defaultSelfTestURLs
+	if url != "" {
+		urls = []string{url}
+	}
+
+	executable, _ := os.Executable()
+	fmt.Printf("dmrRadio %s (commit %s, built %s)\n", version, gitCommit, buildDate)
+	fmt.Printf("%s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("executable: %s\n", executable)
+	if dir, err := os.Getwd(); err == nil {
+		fmt.Printf("directory: %s\n", dir)
+	}
+	fmt.Println()
+
+	failed := 0
+	for _, test := range selfTests(urls) {
+		if skipRadio && test.radio {
+			continue
+		}
+
+		err := test.check()
+		if err == nil {
+			fmt.Printf("PASS %s\n", test.name)
+			continue
+		}
+
+		fmt.Printf("FAIL %s: %s\n", test.name, err.Error())
+		fmt.Printf("\thint: %s\n", test.hint)
+		failed++
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+
+	return nil
+}
+
+func testConnection() error {
+	flags := flag.NewFlagSet("testConnection", flag.ExitOnError)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nOpens the radio's DFU device and closes it again, writing\n")
+		errorf("nothing, to confirm that the radio is reachable in DFU mode.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 0 {
+		flags.Usage()
+	}
+
+	err := openDFU()
+	if err != nil {
+		errorf("hint: %s\n", dfuHint)
+		return err
+	}
+
+	fmt.Println("The radio is connected and in DFU mode")
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/dalefarnsworth-dmr/dfu"
+)
+
+// maxRegionsShown is the number of differing regions that are listed.
+const maxRegionsShown = 20
+
+// A flashRegion is a range of bytes, [start, end), of the SPI flash.
+type flashRegion struct {
+	start int
+	end   int
+}
+
+// differingRegions returns the ranges of offsets, relative to the start
+// of a, at which a and b differ.
+func differingRegions(a []byte, b []byte) []flashRegion {
+	var regions []flashRegion
+	for i := 0; i < len(a); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+
+		start := i
+		for i < len(a) && a[i] != b[i] {
+			i++
+		}
+		regions = append(regions, flashRegion{start, i})
+	}
+
+	return regions
+}
+
+func verifySPIFlash() error {
+	var offset int
+
+	flags := flag.NewFlagSet("verifySPIFlash", flag.ExitOnError)
+	flags.IntVar(&offset, "offset", 0, "byte offset in the flash of the first byte of <filename>")
+	addProgressFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s [-offset <offset>] <filename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nCompares <filename> with the contents of the radio's SPI Flash\n")
+		errorf("starting at <offset>, and lists the regions that differ.  Nothing\n")
+		errorf("is written to the radio.  The whole flash is read, which takes\n")
+		errorf("several minutes.  Offsets may be given in decimal or, with a 0x\n")
+		errorf("prefix, in hex.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
+	filename := args[0]
+
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	if offset < 0 || offset+len(bytes) > spiFlashSize {
+		return fmt.Errorf("%s (size %#x) at offset %#x does not fit in the flash (size %#x)", filename, len(bytes), offset, spiFlashSize)
+	}
+
+	tmp, err := ioutil.TempFile("", "spiflash.*.bin")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	prefixes := []string{
+		"Preparing to read flash",
+		"Reading flash",
+	}
+
+	df, err := dfu.New(progressCallback(prefixes))
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = df.ReadSPIFlash(tmp)
+	df.Close()
+	cerr := tmp.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+
+	flash, err := ioutil.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if offset+len(bytes) > len(flash) {
+		return fmt.Errorf("%s at offset %#x extends past the end of the flash (size %#x)", filename, offset, len(flash))
+	}
+
+	regions := differingRegions(flash[offset:offset+len(bytes)], bytes)
+	if len(regions) == 0 {
+		fmt.Printf("The flash at %#x matches %s\n", offset, filename)
+		return nil
+	}
+
+	differing := 0
+	for i, r := range regions {
+		differing += r.end - r.start
+		if i < maxRegionsShown {
+			fmt.Printf("%#08x-%#08x differs (%d bytes)\n", offset+r.start, offset+r.end-1, r.end-r.start)
+		}
+	}
+	if len(regions) > maxRegionsShown {
+		fmt.Printf("and %d more regions\n", len(regions)-maxRegionsShown)
+	}
+
+	return fmt.Errorf("%d bytes in %d regions of the flash differ from %s", differing, len(regions), filename)
+}
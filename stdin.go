@@ -0,0 +1,121 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// stdinFilename is the codeplug filename that names the standard input.
+const stdinFilename = "-"
+
+// stdinFormat is the format of a codeplug read from the standard input
+// whose format cannot be recognized from its contents.
+var stdinFormat string
+
+func addStdinFlags(flags *flag.FlagSet) {
+	usage := fmt.Sprintf("format of a codeplug piped to standard input, when it cannot be recognized, one of %s", strings.Join(formatNames(), ", "))
+	flags.StringVar(&stdinFormat, "stdin-format", "", usage)
+}
+
+// sniffFormat returns the name of the codeplug format of data, or ""
+// if it cannot be recognized.  A binary codeplug is recognized only by
+// the header of an rdt file.
+func sniffFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("DfuSe")):
+		return "rdt"
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return "xlsx"
+	case bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n\ufeff"), []byte("{")):
+		return "json"
+	case len(data) > 0 && utf8.Valid(data) && bytes.IndexByte(data, 0) < 0:
+		return "text"
+	}
+
+	return ""
+}
+
+// loadStdinCodeplug loads the codeplug piped to the standard input.  Its
+// format is fType, if that is not codeplug.FileTypeNone, else that
+// recognized from its contents, else that given by -stdin-format.
+func loadStdinCodeplug(fType codeplug.FileType) (*codeplug.Codeplug, error) {
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("standard input: %s", err.Error())
+		}
+		data, err = ioutil.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("standard input: %s", err.Error())
+		}
+	}
+
+	name := sniffFormat(data)
+	if name == "" {
+		name = stdinFormat
+	}
+	f, ok := formats[name]
+	if !ok && fType == codeplug.FileTypeNone {
+		if name == "" {
+			return nil, fmt.Errorf("cannot recognize the codeplug format of standard input, use -stdin-format")
+		}
+		return nil, fmt.Errorf("bad -stdin-format %s, must be one of %s", name, strings.Join(formatNames(), ", "))
+	}
+
+	if fType == codeplug.FileTypeNone {
+		fType = fileTypeOf(f.ext)
+	}
+
+	tmp, err := ioutil.TempFile("", "stdin.*"+f.ext)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	cerr := tmp.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return loadCodeplug(fType, tmp.Name())
+}
@@ -0,0 +1,243 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+const ftContactName = codeplug.FieldType("ContactName")
+
+// A talkgroup is a group call contact and the channels, and the zones
+// holding those channels, that use it.
+type talkgroup struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Channels []string `json:"channels"`
+	Zones    []string `json:"zones"`
+}
+
+// A missingContact is a contact named by channels that does not exist.
+type missingContact struct {
+	Name     string   `json:"name"`
+	Channels []string `json:"channels"`
+}
+
+type talkgroupReport struct {
+	Talkgroups []*talkgroup      `json:"talkgroups"`
+	Unused     []*talkgroup      `json:"unused"`
+	Missing    []*missingContact `json:"missing"`
+}
+
+// talkgroups returns the group call contacts of cp that channels use,
+// those that no channel uses, and the contacts channels name that do
+// not exist.
+func talkgroups(cp *codeplug.Codeplug) talkgroupReport {
+	zones := make(map[string][]string)
+	for _, zone := range cp.Records(rtZones) {
+		for _, name := range channelMembers(zone) {
+			if !containsString(zones[name], zone.Name()) {
+				zones[name] = append(zones[name], zone.Name())
+			}
+		}
+	}
+
+	contacts := recordsByName(cp, rtContacts)
+	used := make(map[string]*talkgroup)
+	missing := make(map[string]*missingContact)
+	report := talkgroupReport{
+		Talkgroups: []*talkgroup{},
+		Unused:     []*talkgroup{},
+		Missing:    []*missingContact{},
+	}
+
+	for _, ch := range cp.Records(rtChannels) {
+		f := ch.Field(ftContactName)
+		if f == nil {
+			continue
+		}
+		name := f.String()
+
+		contact := contacts[name]
+		if contact == nil {
+			allowed := false
+			for _, s := range f.Strings() {
+				if s == name {
+					allowed = true
+				}
+			}
+			if allowed {
+				continue
+			}
+
+			m := missing[name]
+			if m == nil {
+				m = &missingContact{Name: name}
+				missing[name] = m
+				report.Missing = append(report.Missing, m)
+			}
+			m.Channels = append(m.Channels, ch.Name())
+			continue
+		}
+
+		if !strings.EqualFold(strings.Join(fieldValues(contact, ftCallType), ","), "Group") {
+			continue
+		}
+
+		tg := used[name]
+		if tg == nil {
+			tg = &talkgroup{
+				ID:       strings.Join(fieldValues(contact, ftCallID), ","),
+				Name:     name,
+				Channels: []string{},
+				Zones:    []string{},
+			}
+			used[name] = tg
+			report.Talkgroups = append(report.Talkgroups, tg)
+		}
+		tg.Channels = append(tg.Channels, ch.Name())
+		for _, zone := range zones[ch.Name()] {
+			if !containsString(tg.Zones, zone) {
+				tg.Zones = append(tg.Zones, zone)
+			}
+		}
+	}
+
+	for _, contact := range cp.Records(rtContacts) {
+		if used[contact.Name()] != nil {
+			continue
+		}
+		if !strings.EqualFold(strings.Join(fieldValues(contact, ftCallType), ","), "Group") {
+			continue
+		}
+
+		report.Unused = append(report.Unused, &talkgroup{
+			ID:       strings.Join(fieldValues(contact, ftCallID), ","),
+			Name:     contact.Name(),
+			Channels: []string{},
+			Zones:    []string{},
+		})
+	}
+
+	sortTalkgroups(report.Talkgroups)
+	sortTalkgroups(report.Unused)
+
+	return report
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortTalkgroups sorts tgs by numeric ID.
+func sortTalkgroups(tgs []*talkgroup) {
+	sort.SliceStable(tgs, func(i, j int) bool {
+		a, _ := strconv.Atoi(tgs[i].ID)
+		b, _ := strconv.Atoi(tgs[j].ID)
+		return a < b
+	})
+}
+
+func listTalkgroups() error {
+	var showChannels bool
+	var asJSON bool
+
+	flags := flag.NewFlagSet("listTalkgroups", flag.ExitOnError)
+	flags.BoolVar(&showChannels, "channels", false, "list the channels and zones that use each talkgroup")
+	flags.BoolVar(&asJSON, "json", false, "print the talkgroups as JSON")
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nLists the ID and name of each group call contact used by a channel\n")
+		errorf("in <codeplugFilename>, then the group call contacts no channel uses\n")
+		errorf("and the contacts that channels name but that do not exist.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, args[0])
+	if err != nil {
+		return err
+	}
+
+	report := talkgroups(cp)
+
+	if asJSON {
+		bytes, err := json.MarshalIndent(report, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bytes))
+		return nil
+	}
+
+	for _, tg := range report.Talkgroups {
+		fmt.Printf("%s\t%s\n", tg.ID, tg.Name)
+		if showChannels {
+			fmt.Printf("\tchannels: %s\n", strings.Join(tg.Channels, ", "))
+			if len(tg.Zones) != 0 {
+				fmt.Printf("\tzones: %s\n", strings.Join(tg.Zones, ", "))
+			}
+		}
+	}
+
+	if len(report.Unused) != 0 {
+		fmt.Println("\nGroup call contacts used by no channel:")
+		for _, tg := range report.Unused {
+			fmt.Printf("%s\t%s\n", tg.ID, tg.Name)
+		}
+	}
+
+	if len(report.Missing) != 0 {
+		fmt.Println("\nContacts named by channels that do not exist:")
+		for _, m := range report.Missing {
+			fmt.Printf("%s\n", m.Name)
+			if showChannels {
+				fmt.Printf("\tchannels: %s\n", strings.Join(m.Channels, ", "))
+			}
+		}
+	}
+
+	return nil
+}
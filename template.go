@@ -0,0 +1,168 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+const templateRecordName = "Example"
+
+// templateCodeplug returns a default codeplug with at least one record,
+// holding default values, of each record type.
+func templateCodeplug(typ string, freqRange string) (*codeplug.Codeplug, error) {
+	cp, err := defaultCodeplug(typ, freqRange)
+	if err != nil {
+		return nil, err
+	}
+
+	present := presentRecordTypes(cp)
+	for _, rType := range cp.RecordTypes() {
+		if present[rType] || cp.MaxRecords(rType) == 0 {
+			continue
+		}
+
+		r := newRecord(cp, rType)
+		if f := r.Field(ftName); f != nil {
+			err = f.SetString(templateRecordName)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = cp.InsertRecord(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cp, nil
+}
+
+// writeCSVTemplate writes a CSV file, in the form read by importCSV,
+// with a header naming the single-valued fields of rType and one row
+// of their default values.
+func writeCSVTemplate(info *modelInfo, rType codeplug.RecordType, filename string) error {
+	rInfo := info.recordInfo(string(rType))
+	if rInfo == nil {
+		return fmt.Errorf("%s has no %s", info.Model, rType)
+	}
+
+	var header []string
+	var row []string
+	for _, f := range rInfo.Fields {
+		if f.MaxCount > 1 {
+			continue
+		}
+
+		value := f.Default
+		if f.Name == string(ftName) {
+			value = templateRecordName
+		}
+		header = append(header, f.Name)
+		row = append(row, value)
+	}
+
+	return createFileAtomically(filename, func(file io.Writer) error {
+		w := csv.NewWriter(file)
+		w.Write(header)
+		w.Write(row)
+		w.Flush()
+		return w.Error()
+	})
+}
+
+func exportTemplate() error {
+	var typ string
+	var freq string
+	var to string
+	rTypeName := string(rtChannels)
+
+	flags := flag.NewFlagSet("exportTemplate", flag.ExitOnError)
+	addModelFlags(flags, &typ, &freq)
+	flags.StringVar(&to, "format", "", "format of the template: text, json, xlsx, or csv")
+	flags.StringVar(&rTypeName, "type", rTypeName, "record type of a csv template, Channels or Contacts")
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s -model <modelName> -freq <freqRange> -format <format> <filename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nWrites a template for codeplugs of the given model in the given\n")
+		errorf("format, with one %q record of each type showing every\n", templateRecordName)
+		errorf("field at its default value.  A csv template holds one record\n")
+		errorf("type, selected by -type, in the form read by importCSV.\n")
+		errorf("The valid values of each field are listed by fieldInfo.\n\n")
+		printModelsUsage()
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
+	checkModelFlags(flags, &typ, &freq)
+	filename := args[0]
+
+	if to == "csv" {
+		var rType codeplug.RecordType
+		switch strings.ToLower(rTypeName) {
+		case "channels":
+			rType = rtChannels
+		case "contacts":
+			rType = rtContacts
+		default:
+			errorf("bad record type: %s\n\n", rTypeName)
+			flags.Usage()
+		}
+
+		info, err := schema(typ, freq)
+		if err != nil {
+			return err
+		}
+
+		return writeCSVTemplate(info, rType, withExtension(filename, ".csv"))
+	}
+
+	f, ok := formats[to]
+	if !ok || to == "rdt" {
+		errorf("bad format: %s\n\n", to)
+		flags.Usage()
+	}
+
+	cp, err := templateCodeplug(typ, freq)
+	if err != nil {
+		return err
+	}
+
+	filename = withExtension(filename, f.ext)
+
+	return writeFormat(cp, f, filename)
+}
@@ -0,0 +1,700 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dalefarnsworth-dmr/userdb"
+)
+
+// A usersEdit modifies the users of a database before they are written.
+type usersEdit func(users []*userdb.User) error
+
+type locale struct {
+	country string
+	states  map[string]string
+}
+
+// locales holds the abbreviations of the states and provinces of
+// countries other than the United States, which userdb abbreviates.
+var locales = map[string]locale{
+	"AU": {
+		country: "Australia",
+		states: map[string]string{
+			"Australian Capital Territory": "ACT",
+			"New South Wales":              "NSW",
+			"Northern Territory":           "NT",
+			"Queensland":                   "QLD",
+			"South Australia":              "SA",
+			"Tasmania":                     "TAS",
+			"Victoria":                     "VIC",
+			"Western Australia":            "WA",
+		},
+	},
+	"CA": {
+		country: "Canada",
+		states: map[string]string{
+			"Alberta":                   "AB",
+			"British Columbia":          "BC",
+			"Manitoba":                  "MB",
+			"New Brunswick":             "NB",
+			"Newfoundland and Labrador": "NL",
+			"Northwest Territories":     "NT",
+			"Nova Scotia":               "NS",
+			"Nunavut":                   "NU",
+			"Ontario":                   "ON",
+			"Prince Edward Island":      "PE",
+			"Quebec":                    "QC",
+			"Saskatchewan":              "SK",
+			"Yukon":                     "YT",
+		},
+	},
+}
+
+func localeCodes() []string {
+	codes := make([]string, 0, len(locales))
+	for code := range locales {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	return codes
+}
+
+// abbreviateLocale returns a usersEdit that abbreviates the state names
+// of users in the country of the locale with the given code.
+func abbreviateLocale(code string) (usersEdit, error) {
+	loc, ok := locales[strings.ToUpper(code)]
+	if !ok {
+		return nil, fmt.Errorf("unknown locale %s, must be one of %s", code, strings.Join(localeCodes(), ", "))
+	}
+
+	return func(users []*userdb.User) error {
+		for _, u := range users {
+			if u.Country != loc.country {
+				continue
+			}
+			abbrev, ok := loc.states[u.State]
+			if ok {
+				u.State = abbrev
+			}
+		}
+		return nil
+	}, nil
+}
+
+// userWriteOptions holds the flags shared by the subcommands that
+// write a user database to the radio.
+type userWriteOptions struct {
+	fromURL       string
+	nameFormat    string
+	maxNameLength int
+	userFileOptions
+}
+
+func (o *userWriteOptions) addFlags(flags *flag.FlagSet) {
+	o.userFileOptions.addFlags(flags)
+	addProgressFlags(flags)
+	flags.StringVar(&o.fromURL, "from-url", "", "download the users file from this URL instead of naming a file")
+	addDownloadFlags(flags)
+	flags.StringVar(&o.nameFormat, "name-format", "", "compose each user's name field from {callsign}, {name}, {nick}, {city}, {state}, and {country}")
+	flags.IntVar(&o.maxNameLength, "max-name-length", 0, "shorten each user's callsign, name, and city to fit in this many characters")
+}
+
+func (o *userWriteOptions) edits() []usersEdit {
+	var edits []usersEdit
+	if o.nameFormat != "" {
+		edits = append(edits, formatName(o.nameFormat))
+	}
+	if o.maxNameLength > 0 {
+		edits = append(edits, limitNameLength(o.maxNameLength))
+	}
+
+	return edits
+}
+
+// usersFilename returns the users file named in args, which must be
+// empty if -from-url was given.
+func (o *userWriteOptions) usersFilename(flags *flag.FlagSet) string {
+	args := flags.Args()
+	if o.fromURL != "" {
+		if len(args) != 0 {
+			flags.Usage()
+		}
+		return ""
+	}
+
+	if len(args) != 1 {
+		flags.Usage()
+	}
+
+	return args[0]
+}
+
+// source describes where the users come from, for messages.
+func (o *userWriteOptions) source(filename string) string {
+	if o.fromURL != "" {
+		return o.fromURL
+	}
+
+	return filename
+}
+
+func (o *userWriteOptions) loadUsers(filename string) (*userdb.UsersDB, error) {
+	source := o.source(filename)
+	if o.fromURL != "" {
+		tmpName, err := downloadFile(o.fromURL)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmpName)
+
+		filename = tmpName
+	}
+
+	err := o.verify(filename, source)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := usersFromFile(filename, userdb.Abbreviate(false))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, edit := range o.edits() {
+		err = edit(db.Users())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+func displayName(u *userdb.User) string {
+	var parts []string
+	for _, part := range []string{u.Callsign, u.Name, u.City} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// limitNameLength returns a usersEdit that shortens each user so that
+// the callsign, name, and city fit in max characters, counted as runes
+// so that a name is never cut within a character.  The city is
+// dropped first, then trailing words of the name, and finally the
+// name is truncated.  The callsign is never shortened.
+func limitNameLength(max int) usersEdit {
+	return func(users []*userdb.User) error {
+		for _, u := range users {
+			if utf8.RuneCountInString(displayName(u)) <= max {
+				continue
+			}
+
+			u.City = ""
+
+			words := strings.Fields(u.Name)
+			for len(words) > 1 && utf8.RuneCountInString(displayName(u)) > max {
+				words = words[:len(words)-1]
+				u.Name = strings.Join(words, " ")
+			}
+
+			excess := utf8.RuneCountInString(displayName(u)) - max
+			if excess > 0 {
+				name := []rune(u.Name)
+				if excess >= len(name) {
+					u.Name = ""
+				} else {
+					u.Name = strings.TrimSpace(string(name[:len(name)-excess]))
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// formatName returns a usersEdit that replaces each user's name with
+// format, after substituting the user's fields for its placeholders.
+func formatName(format string) usersEdit {
+	return func(users []*userdb.User) error {
+		for _, u := range users {
+			replacer := strings.NewReplacer(
+				"{callsign}", u.Callsign,
+				"{name}", u.Name,
+				"{nick}", u.Nickname,
+				"{city}", u.City,
+				"{state}", u.State,
+				"{country}", u.Country,
+			)
+			u.Name = strings.Join(strings.Fields(replacer.Replace(format)), " ")
+		}
+		return nil
+	}
+}
+
+// countryAliases lists the names used for the same country by the
+// various user database sources.  The first name of each is canonical.
+var countryAliases = [][]string{
+	{"United States", "USA", "US", "U.S.A.", "United States of America"},
+	{"United Kingdom", "UK", "U.K.", "Great Britain"},
+	{"Germany", "Deutschland"},
+	{"Netherlands", "The Netherlands", "Holland"},
+	{"Russia", "Russian Federation"},
+	{"South Korea", "Korea, Republic of", "Republic of Korea"},
+	{"Czech Republic", "Czechia"},
+	{"Taiwan", "Taiwan, Province of China"},
+}
+
+// readCountryAliases adds the aliases in filename to countryAliases.
+// Each line has the form "<country> = <alias>, <alias>, ...".  Blank
+// lines and text following a '#' are ignored.
+func readCountryAliases(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	lineNo := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.SplitN(scanner.Text(), "#", 2)[0]
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("%s:%d: expected <country> = <alias>, ...", filename, lineNo)
+		}
+
+		aliases := []string{strings.TrimSpace(parts[0])}
+		aliases = append(aliases, splitList(parts[1])...)
+		countryAliases = append(countryAliases, aliases)
+	}
+
+	return scanner.Err()
+}
+
+// expandCountryAliases returns countries plus all of their aliases.
+func expandCountryAliases(countries []string) []string {
+	seen := make(map[string]bool)
+	var expanded []string
+
+	add := func(country string) {
+		if !seen[country] {
+			seen[country] = true
+			expanded = append(expanded, country)
+		}
+	}
+
+	for _, country := range countries {
+		add(country)
+		for _, aliases := range countryAliases {
+			for _, alias := range aliases {
+				if strings.EqualFold(alias, country) {
+					for _, alias := range aliases {
+						add(alias)
+					}
+					break
+				}
+			}
+		}
+	}
+
+	return expanded
+}
+
+func listCountryAliases() error {
+	var aliasFilename string
+
+	flags := flag.NewFlagSet("listCountryAliases", flag.ExitOnError)
+	flags.StringVar(&aliasFilename, "alias-file", "", "file of additional country aliases")
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nLists the alternate country names that filterUsers treats as equivalent.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 0 {
+		flags.Usage()
+	}
+
+	if aliasFilename != "" {
+		err := readCountryAliases(aliasFilename)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, aliases := range countryAliases {
+		fmt.Printf("%s = %s\n", aliases[0], strings.Join(aliases[1:], ", "))
+	}
+
+	return nil
+}
+
+// userReadOptions holds the flags shared by the subcommands that read
+// a user database.
+type userReadOptions struct {
+	normalize         bool
+	titleCase         bool
+	reportParseErrors bool
+}
+
+func (o *userReadOptions) addFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&o.normalize, "normalize", false, "trim surrounding and repeated whitespace from user fields")
+	flags.BoolVar(&o.titleCase, "title-case", false, "normalize, and capitalize names and cities")
+	flags.BoolVar(&o.reportParseErrors, "report-parse-errors", false, "report the number of users parsed and the rows that could not be parsed")
+}
+
+// maxParseErrorSamples is the number of unparsable rows that are shown.
+const maxParseErrorSamples = 5
+
+// checkParse reports the number of users in db.  If filename, the file
+// db was read from, is given, it also reports the rows of filename
+// whose ID is not that of a user in db.
+func (o *userReadOptions) checkParse(db *userdb.UsersDB, filename string) error {
+	if !o.reportParseErrors {
+		return nil
+	}
+
+	users := db.Users()
+	fmt.Printf("%d users parsed\n", len(users))
+	if filename == "" {
+		return nil
+	}
+
+	ids := make(map[string]bool)
+	for _, u := range users {
+		ids[strconv.Itoa(u.ID)] = true
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var samples []string
+	bad := 0
+	lineNo := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if !strings.Contains(line, ",") {
+			continue
+		}
+
+		id := strings.TrimSpace(strings.SplitN(line, ",", 2)[0])
+		if ids[id] {
+			continue
+		}
+
+		bad++
+		if len(samples) < maxParseErrorSamples {
+			samples = append(samples, fmt.Sprintf("%s:%d: %s", filename, lineNo, line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if bad != 0 {
+		fmt.Printf("%d rows could not be parsed, including:\n", bad)
+		for _, sample := range samples {
+			fmt.Printf("\t%s\n", sample)
+		}
+	}
+
+	return nil
+}
+
+func (o *userReadOptions) edits() []usersEdit {
+	var edits []usersEdit
+	if o.normalize || o.titleCase {
+		edits = append(edits, normalizeUsers(o.titleCase))
+	}
+
+	return edits
+}
+
+func (o *userReadOptions) editUsers(db *userdb.UsersDB) error {
+	for _, edit := range o.edits() {
+		err := edit(db.Users())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// countries returns the sorted countries of the users in db.
+func (o *userReadOptions) countries(db *userdb.UsersDB) ([]string, error) {
+	if len(o.edits()) == 0 {
+		return db.AllCountries()
+	}
+
+	seen := make(map[string]bool)
+	var countries []string
+	for _, u := range db.Users() {
+		if !seen[u.Country] {
+			seen[u.Country] = true
+			countries = append(countries, u.Country)
+		}
+	}
+	sort.Strings(countries)
+
+	return countries, nil
+}
+
+func titleCase(s string) string {
+	words := strings.Fields(strings.ToLower(s))
+	for i, word := range words {
+		r, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToUpper(r)) + word[size:]
+	}
+
+	return strings.Join(words, " ")
+}
+
+// normalizeUsers returns an edit that removes surrounding and repeated
+// white space from the users' fields and, if title is true, capitalizes
+// their names and cities.  userdb already title cases every field each
+// time Users is called, but only for the upper-case words in its own
+// list; title covers the rest.
+func normalizeUsers(title bool) usersEdit {
+	clean := func(s string) string {
+		return strings.Join(strings.Fields(s), " ")
+	}
+
+	return func(users []*userdb.User) error {
+		for _, u := range users {
+			u.Callsign = clean(u.Callsign)
+			u.Name = clean(u.Name)
+			u.Nickname = clean(u.Nickname)
+			u.City = clean(u.City)
+			u.State = clean(u.State)
+			u.Country = clean(u.Country)
+
+			// States and countries are often abbreviations, such
+			// as NSW or USA, which title case would spoil.
+			if title {
+				u.Name = titleCase(u.Name)
+				u.City = titleCase(u.City)
+			}
+		}
+		return nil
+	}
+}
+
+// usersFromFile returns a user database read from filename, which may
+// be gzip-compressed, with the given options applied.
+func usersFromFile(filename string, options ...userdb.DBOption) (*userdb.UsersDB, error) {
+	name, cleanup, err := uncompressed(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	options = append(options, userdb.FromFile(name))
+	db, err := userdb.New(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the users now, before any temporary file is removed.
+	db.Users()
+
+	return db, nil
+}
+
+// userFileOptions holds the flags shared by the subcommands that read
+// a users file.
+type userFileOptions struct {
+	expectSHA256 string
+}
+
+func (o *userFileOptions) addFlags(flags *flag.FlagSet) {
+	flags.StringVar(&o.expectSHA256, "expect-sha256", "", "refuse to use a users file whose SHA-256 checksum is not this hex string")
+}
+
+// verify returns an error if -expect-sha256 was given and filename,
+// described as source in messages, does not have that checksum.
+func (o *userFileOptions) verify(filename string, source string) error {
+	if o.expectSHA256 == "" {
+		return nil
+	}
+
+	sum, err := fileSHA256(filename)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(sum, strings.TrimSpace(o.expectSHA256)) {
+		return fmt.Errorf("%s: SHA-256 checksum is %s, expected %s", source, sum, o.expectSHA256)
+	}
+
+	return nil
+}
+
+// usersFromFile is usersFromFile preceded by verify.
+func (o *userFileOptions) usersFromFile(filename string, options ...userdb.DBOption) (*userdb.UsersDB, error) {
+	err := o.verify(filename, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return usersFromFile(filename, options...)
+}
+
+// userOutputOptions holds the flags shared by the subcommands that
+// write a users file.
+type userOutputOptions struct {
+	count  bool
+	gzip   bool
+	filter userFilterValue
+}
+
+func (o *userOutputOptions) addFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&o.count, "count", false, "report the number of users retrieved, once they are parsed")
+	flags.BoolVar(&o.gzip, "gzip", false, "gzip-compress the users file")
+	flags.Var(&o.filter, "filter", "write only the users matching this expression, e.g. 'country == Canada || callsign =~ ^ZL'")
+	addProgressFlags(flags)
+}
+
+// writeUsersFile writes the users of db that match -filter to filename
+// and returns their number.
+func (o *userOutputOptions) writeUsersFile(db *userdb.UsersDB, filename string) (int, error) {
+	users := db.Users()
+	if o.filter.filter != nil {
+		users = o.filter.apply(users)
+	}
+
+	err := writeFileAtomically(filename, func(tmpName string) error {
+		err := writeMD380ToolsUsers(users, tmpName)
+		if err != nil || !o.gzip {
+			return err
+		}
+
+		return gzipFile(tmpName)
+	})
+
+	return len(users), err
+}
+
+// writeMD380ToolsUsers writes users to filename in the form written by
+// userdb's WriteMD380ToolsFile: a line holding the length of the rest
+// of the file, then a line for each user.
+func writeMD380ToolsUsers(users []*userdb.User, filename string) error {
+	var b strings.Builder
+	for _, u := range users {
+		fmt.Fprintf(&b, "%d,%s,%s,%s,%s,%s,%s\n",
+			u.ID, u.Callsign, u.Name, u.City, u.State, u.Nickname, u.Country)
+	}
+	str := b.String()
+
+	return ioutil.WriteFile(filename, []byte(fmt.Sprintf("%d\n%s", len(str), str)), 0644)
+}
+
+// userFilterFields are the user fields that a -filter expression may
+// compare.
+var userFilterFields = []string{"id", "callsign", "name", "city", "state", "nick", "country"}
+
+func userFieldValue(u *userdb.User, field string) string {
+	switch field {
+	case "id":
+		return strconv.Itoa(u.ID)
+	case "callsign":
+		return u.Callsign
+	case "name":
+		return u.Name
+	case "city":
+		return u.City
+	case "state":
+		return u.State
+	case "nick":
+		return u.Nickname
+	case "country":
+		return u.Country
+	}
+
+	return ""
+}
+
+// A userFilterValue is a -filter flag selecting users.
+type userFilterValue struct {
+	expr   string
+	filter filter
+}
+
+func (v *userFilterValue) String() string {
+	return v.expr
+}
+
+func (v *userFilterValue) Set(s string) error {
+	f, err := parseFilter(s, userFilterFields)
+	if err != nil {
+		return err
+	}
+
+	v.expr = s
+	v.filter = f
+	return nil
+}
+
+// apply returns the users that match the filter.
+func (v *userFilterValue) apply(users []*userdb.User) []*userdb.User {
+	var kept []*userdb.User
+	for _, u := range users {
+		if v.filter.match(func(field string) string { return userFieldValue(u, field) }) {
+			kept = append(kept, u)
+		}
+	}
+
+	fmt.Printf("Selected %d of %d users by -filter\n", len(kept), len(users))
+	return kept
+}
@@ -24,3 +24,10 @@
 package main
 
 const version = "1.0.33"
+
+// gitCommit and buildDate are set at build time by the Makefile with
+// -ldflags "-X main.gitCommit=... -X main.buildDate=...".
+var (
+	gitCommit = "unknown"
+	buildDate = "unknown"
+)
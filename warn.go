@@ -0,0 +1,61 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// warningsAsErrors is set by the global -warnings-as-errors flag.
+var warningsAsErrors bool
+
+// warnf reports a problem that an operation works around, such as an
+// ignored column or a skipped record, and returns nil so that the
+// operation continues.  With -warnings-as-errors, it instead returns
+// the problem as an error, for the caller to return.
+func warnf(format string, v ...interface{}) error {
+	msg := fmt.Sprintf(format, v...)
+	if warningsAsErrors {
+		return fmt.Errorf("%s (-warnings-as-errors)", msg)
+	}
+
+	errorf("warning: %s\n", msg)
+	return nil
+}
+
+// parseGlobalFlags removes the flags that precede the subcommand from
+// os.Args, so that os.Args[1] names the subcommand.
+func parseGlobalFlags() {
+	for len(os.Args) > 1 && strings.HasPrefix(os.Args[1], "-") {
+		switch strings.TrimLeft(os.Args[1], "-") {
+		case "warnings-as-errors":
+			warningsAsErrors = true
+		default:
+			usage()
+		}
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+}
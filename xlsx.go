@@ -0,0 +1,186 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+	"github.com/dalefarnsworth-dmr/userdb"
+	"github.com/tealeg/xlsx/v3"
+)
+
+// xlsxCellValue returns the text of cell as the codeplug parser should
+// see it.  Numeric cells yield their stored value rather than the value
+// as displayed under the cell's number format, and surrounding white
+// space, including the non-breaking spaces Excel sometimes keeps, is
+// removed.
+func xlsxCellValue(cell *xlsx.Cell) (string, error) {
+	if cell.Formula() != "" && cell.Value == "" {
+		return "", fmt.Errorf("formula =%s has no computed value", cell.Formula())
+	}
+
+	switch cell.Type() {
+	case xlsx.CellTypeNumeric:
+		str := strings.TrimSpace(cell.Value)
+		if str == "" {
+			return "", nil
+		}
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return "", fmt.Errorf("bad number %q", cell.Value)
+		}
+		// Excel keeps 15 significant digits, so round away the
+		// binary floating point noise, e.g. 440.10000000000002.
+		f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', 15, 64), 64)
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+
+	case xlsx.CellTypeError:
+		return "", fmt.Errorf("error value %s", cell.Value)
+	}
+
+	str := strings.Replace(cell.String(), "\u00a0", " ", -1)
+	return strings.TrimSpace(str), nil
+}
+
+// normalizedXLSX returns the name of a temporary copy of the spreadsheet
+// in filename with each cell replaced by its xlsxCellValue.  Cells that
+// cannot be interpreted are reported using displayName and cause an
+// error, rather than being misread.  The returned function removes the
+// temporary file and must be called.
+func normalizedXLSX(filename string, displayName string) (string, func(), error) {
+	file, err := xlsx.OpenFile(filename)
+	if err != nil {
+		return "", func() {}, fmt.Errorf("%s: %s", displayName, err.Error())
+	}
+
+	var problems []string
+	for _, sheet := range file.Sheets {
+		err := sheet.ForEachRow(func(row *xlsx.Row) error {
+			return row.ForEachCell(func(cell *xlsx.Cell) error {
+				value, err := xlsxCellValue(cell)
+				if err != nil {
+					x, y := cell.GetCoordinates()
+					cellID := xlsx.GetCellIDStringFromCoords(x, y)
+					problems = append(problems, fmt.Sprintf("%s!%s: %s", sheet.Name, cellID, err.Error()))
+					return nil
+				}
+				if value != cell.String() || cell.Type() != xlsx.CellTypeString {
+					cell.SetString(value)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return "", func() {}, fmt.Errorf("%s: %s", displayName, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			errorf("%s: %s\n", displayName, problem)
+		}
+		return "", func() {}, fmt.Errorf("%s: %d cells could not be interpreted", displayName, len(problems))
+	}
+
+	tmp, err := ioutil.TempFile("", "normalized.*.xlsx")
+	if err != nil {
+		return "", func() {}, err
+	}
+	tmpName := tmp.Name()
+
+	err = file.Write(tmp)
+	cerr := tmp.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return "", func() {}, err
+	}
+
+	return tmpName, func() { os.Remove(tmpName) }, nil
+}
+
+// exportXLSX writes cp to filename in the layout of
+// codeplug.ExportXLSX, with a first column of record numbers, calling
+// progress after each record.  If progress returns an error, the
+// export is abandoned and that error is returned.
+func exportXLSX(cp *codeplug.Codeplug, filename string, progress func(cur int) error) error {
+	total := 0
+	for _, rType := range cp.RecordTypes() {
+		total += len(cp.Records(rType))
+	}
+
+	err := progress(0)
+	if err != nil {
+		return err
+	}
+
+	file := xlsx.NewFile()
+	done := 0
+	for _, rType := range cp.RecordTypes() {
+		sheet, err := file.AddSheet(string(rType))
+		if err != nil {
+			return err
+		}
+
+		records := cp.Records(rType)
+		header := sheet.AddRow()
+		header.AddCell().Value = numberColumn
+		r := records[0]
+		for _, fType := range r.FieldTypes() {
+			for i := 0; i < r.MaxFields(fType); i++ {
+				header.AddCell().Value = string(fType)
+			}
+		}
+
+		for _, r := range records {
+			row := sheet.AddRow()
+			row.AddCell().SetInt(recordNumber(r))
+			for _, fType := range r.FieldTypes() {
+				for _, f := range r.Fields(fType) {
+					row.AddCell().Value = f.String()
+				}
+			}
+
+			done++
+			err = progress(done * (userdb.MaxProgress - 1) / total)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = file.Save(filename)
+	if err != nil {
+		return err
+	}
+
+	return progress(userdb.MaxProgress)
+}
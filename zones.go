@@ -0,0 +1,475 @@
+// Copyright 2017-2020 Dale Farnsworth. All rights reserved.
+
+// Dale Farnsworth
+// 1007 W Mendoza Ave
+// Mesa, AZ  85210
+// USA
+//
+// dale@farnsworth.org
+
+// This file is part of Radio.
+//
+// Radio is free software: you can redistribute it and/or modify
+// it under the terms of version 3 of the GNU Lesser General Public
+// License as published by the Free Software Foundation.
+//
+// Radio is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Radio.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dalefarnsworth-dmr/codeplug"
+)
+
+// zoneMembers returns the values of each field of zone r other than
+// its name, as sets.
+func zoneMembers(r *codeplug.Record) map[codeplug.FieldType]map[string]bool {
+	members := make(map[codeplug.FieldType]map[string]bool)
+	for _, fType := range r.FieldTypes() {
+		if fType == ftName {
+			continue
+		}
+
+		set := make(map[string]bool)
+		for _, value := range fieldValues(r, fType) {
+			set[value] = true
+		}
+		members[fType] = set
+	}
+
+	return members
+}
+
+// membershipKey returns a string that is equal for zones with the same
+// members, regardless of their order.
+func membershipKey(members map[codeplug.FieldType]map[string]bool) string {
+	var parts []string
+	for fType, set := range members {
+		var values []string
+		for value := range set {
+			values = append(values, value)
+		}
+		sort.Strings(values)
+		parts = append(parts, string(fType)+"="+strings.Join(values, "\x00"))
+	}
+	sort.Strings(parts)
+
+	return strings.Join(parts, "\n")
+}
+
+// isSubset reports whether a has members and every one of them is a
+// member of b.
+func isSubset(a map[codeplug.FieldType]map[string]bool, b map[codeplug.FieldType]map[string]bool) bool {
+	empty := true
+	for fType, set := range a {
+		for value := range set {
+			if !b[fType][value] {
+				return false
+			}
+			empty = false
+		}
+	}
+
+	return !empty
+}
+
+func dedupeZones() error {
+	var ed editor
+
+	flags := flag.NewFlagSet("dedupeZones", flag.ExitOnError)
+	ed.addFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s <codeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nRemoves each zone in <codeplugFilename> that has the same channels\n")
+		errorf("as an earlier zone, and points references to it at the earlier zone.\n")
+		errorf("Zones whose channels are all in another zone are reported.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
+	filename := args[0]
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	type zone struct {
+		r       *codeplug.Record
+		members map[codeplug.FieldType]map[string]bool
+	}
+
+	var kept []zone
+	keptByKey := make(map[string]*codeplug.Record)
+	replacements := make(map[string]string)
+	// RemoveRecord shifts the records, so iterate over a copy.
+	for _, r := range append([]*codeplug.Record(nil), cp.Records(rtZones)...) {
+		members := zoneMembers(r)
+		key := membershipKey(members)
+
+		first := keptByKey[key]
+		if first == nil {
+			keptByKey[key] = r
+			kept = append(kept, zone{r, members})
+			continue
+		}
+
+		fmt.Printf("%s: same channels as %s, merged\n", recordName(r), recordName(first))
+		replacements[r.Name()] = first.Name()
+		ed.record(r, "", "", "removed")
+		cp.RemoveRecord(r)
+	}
+
+	for _, ref := range references(cp) {
+		if ref.target != rtZones {
+			continue
+		}
+
+		name, ok := replacements[ref.field.String()]
+		if !ok {
+			continue
+		}
+
+		err = ed.setField(ref.field, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, a := range kept {
+		for _, b := range kept {
+			if a.r != b.r && isSubset(a.members, b.members) {
+				fmt.Printf("%s: all of its channels are in %s\n", recordName(a.r), recordName(b.r))
+			}
+		}
+	}
+
+	if len(replacements) == 0 {
+		fmt.Println("No duplicate zones")
+	}
+
+	return ed.save(cp, filename)
+}
+
+// zoneSize returns the number of channels in the longest channel list
+// of zone r.
+func zoneSize(r *codeplug.Record) int {
+	size := 0
+	for _, fType := range memberFieldTypes(r) {
+		if n := len(r.Fields(fType)); n > size {
+			size = n
+		}
+	}
+
+	return size
+}
+
+// splitZone moves the channels of zone r beyond the first max into new
+// zones, so that no zone has more than max channels.  Both channel
+// lists of a dual-band zone are split alike.  The zones are named after
+// r and numbered from 1.
+func (m *merger) splitZone(r *codeplug.Record, max int) error {
+	count := zoneSize(r)
+	if count <= max {
+		return nil
+	}
+
+	name := r.Name()
+	names := recordsByName(m.cp, rtZones)
+	for i := max; i < count; i += max {
+		zoneName := fmt.Sprintf("%s %d", name, i/max+1)
+		if names[zoneName] != nil {
+			return fmt.Errorf("%s: a zone named %q already exists", recordName(r), zoneName)
+		}
+	}
+
+	for i := max; i < count; i += max {
+		zone, err := m.addRecord(rtZones, fmt.Sprintf("%s %d", name, i/max+1))
+		if err != nil {
+			return err
+		}
+
+		for _, fType := range memberFieldTypes(r) {
+			channels := fieldValues(r, fType)
+			for j := i; j < i+max && j < len(channels); j++ {
+				err = m.addField(zone, fType, channels[j])
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, fType := range memberFieldTypes(r) {
+		fields := r.Fields(fType)
+		if len(fields) <= max {
+			continue
+		}
+		for _, f := range append([]*codeplug.Field(nil), fields[max:]...) {
+			m.ed.record(r, f.TypeName(), f.String(), "")
+			r.RemoveField(f)
+		}
+	}
+
+	// References are checked against the zone names, so rename the
+	// zone before pointing them at its new name.
+	newName := fmt.Sprintf("%s %d", name, 1)
+	err := m.ed.setField(r.Field(ftName), newName)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range references(m.cp) {
+		if ref.target == rtZones && ref.field.String() == name {
+			err := m.ed.setField(ref.field, newName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func splitZones() error {
+	var max int
+	var ed editor
+
+	flags := flag.NewFlagSet("splitZones", flag.ExitOnError)
+	flags.IntVar(&max, "max", 0, "maximum number of channels in a zone")
+	ed.addFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s -max <n> <codeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nSplits each zone in <codeplugFilename> that has more than <n>\n")
+		errorf("channels into zones of at most <n> channels, keeping the channels\n")
+		errorf("in order.  A zone named Statewide becomes Statewide 1, Statewide 2,\n")
+		errorf("and so on.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 || max <= 0 {
+		flags.Usage()
+	}
+	filename := args[0]
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	m := merger{ed: &ed, cp: cp}
+	split := 0
+	for _, r := range cp.Records(rtZones) {
+		count := zoneSize(r)
+		if count <= max {
+			continue
+		}
+
+		zones := (count + max - 1) / max
+		fmt.Printf("%s: %d channels, split into %d zones\n", recordName(r), count, zones)
+		err = m.splitZone(r, max)
+		if err != nil {
+			return err
+		}
+		split++
+	}
+
+	if split == 0 {
+		fmt.Printf("No zone has more than %d channels\n", max)
+	}
+
+	return ed.save(cp, filename)
+}
+
+// lessValue orders field values numerically if both are numbers, and
+// as strings otherwise.
+func lessValue(a string, b string) bool {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		return x < y
+	}
+
+	return a < b
+}
+
+// sortZone orders the channels of zone r by the value of field fType of
+// each channel.  Each channel list of a dual-band zone is sorted on its
+// own.  Channels that do not exist keep their place at the end.
+func (e *editor) sortZone(r *codeplug.Record, channels map[string]*codeplug.Record, fType codeplug.FieldType) error {
+	key := func(name string) (string, bool) {
+		channel := channels[name]
+		if channel == nil || channel.Field(fType) == nil {
+			return "", false
+		}
+		return channel.Field(fType).String(), true
+	}
+
+	for _, memberType := range memberFieldTypes(r) {
+		fields := r.Fields(memberType)
+		names := fieldValues(r, memberType)
+		sort.SliceStable(names, func(i, j int) bool {
+			a, okA := key(names[i])
+			b, okB := key(names[j])
+			if okA != okB {
+				return okA
+			}
+			return okA && lessValue(a, b)
+		})
+
+		for i, f := range fields {
+			err := e.setField(f, names[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func sortZoneChannels() error {
+	var zoneName string
+	by := string(ftName)
+	var ed editor
+
+	flags := flag.NewFlagSet("sortZoneChannels", flag.ExitOnError)
+	flags.StringVar(&zoneName, "zone", "", "sort only the channels of this zone")
+	flags.StringVar(&by, "by", by, "channel field to sort by, e.g. RxFrequency")
+	ed.addFlags(flags)
+
+	flags.Usage = func() {
+		errorf("Usage: %s %s [-zone <name>] -by <field> <codeplugFilename>\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		errorf("\nSorts the channels of each zone in <codeplugFilename> by the\n")
+		errorf("given channel field, numerically if its values are numbers.\n")
+		errorf("The order of the channels themselves is unchanged.\n")
+		os.Exit(1)
+	}
+
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+	}
+	filename := args[0]
+
+	cp, err := loadCodeplug(codeplug.FileTypeNone, filename)
+	if err != nil {
+		return err
+	}
+
+	fType := codeplug.FieldType(by)
+	found := false
+	for _, t := range newRecord(cp, rtChannels).AllFieldTypes() {
+		if t == fType {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown channel field: %s", by)
+	}
+
+	zones := cp.Records(rtZones)
+	if zoneName != "" {
+		r := recordsByName(cp, rtZones)[zoneName]
+		if r == nil {
+			return fmt.Errorf("%s: no zone named %q", filename, zoneName)
+		}
+		zones = []*codeplug.Record{r}
+	}
+
+	channels := recordsByName(cp, rtChannels)
+	for _, r := range zones {
+		err = ed.sortZone(r, channels, fType)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ed.save(cp, filename)
+}
+
+func writeChannel(w *bufio.Writer, r *codeplug.Record) {
+	fmt.Fprintf(w, "\t%s\n", r.Name())
+	for _, fType := range r.FieldTypes() {
+		if fType == ftName {
+			continue
+		}
+		fmt.Fprintf(w, "\t\t%s: %s\n", fType, strings.Join(fieldValues(r, fType), ", "))
+	}
+}
+
+// exportTextByZone writes the channels of cp to filename listed under
+// each zone that contains them, in the order of the zone, followed by
+// the channels in no zone under "Unzoned".
+func exportTextByZone(cp *codeplug.Codeplug, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	channels := recordsByName(cp, rtChannels)
+	zoned := make(map[string]bool)
+
+	for _, zone := range cp.Records(rtZones) {
+		fmt.Fprintf(w, "Zone: %s\n", zone.Name())
+		fTypes := memberFieldTypes(zone)
+		for _, fType := range fTypes {
+			if len(fTypes) > 1 {
+				fmt.Fprintf(w, "%s:\n", fType)
+			}
+			for _, name := range fieldValues(zone, fType) {
+				zoned[name] = true
+				r := channels[name]
+				if r == nil {
+					fmt.Fprintf(w, "\t%s (no such channel)\n", name)
+					continue
+				}
+				writeChannel(w, r)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "Unzoned\n")
+	for _, r := range cp.Records(rtChannels) {
+		if !zoned[r.Name()] {
+			writeChannel(w, r)
+		}
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}